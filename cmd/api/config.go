@@ -0,0 +1,645 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/cron"
+	"github.com/Alphasxd/greenlight/internal/jsonlog"
+	"github.com/Alphasxd/greenlight/internal/ratelimit"
+	"github.com/Alphasxd/greenlight/internal/validator"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 定义配置结构体
+type config struct {
+	port           int
+	env            string
+	logLevel       jsonlog.Level
+	displayVersion bool
+	trustedProxies []netip.Prefix
+	db             struct {
+		dsn          string
+		maxOpenConns int
+		maxIdleConns int
+		maxIdleTime  string
+	}
+	limiter struct {
+		rps        float64
+		burst      int
+		enabled    bool
+		store      string
+		policies   []limiterPolicy
+		floodRPS   float64
+		floodBurst int
+	}
+	tls struct {
+		certFile     string
+		keyFile      string
+		redirectPort int
+		publicHost   string
+		publicPort   int
+		clientCA     string
+		clientAuth   string
+	}
+	mail struct {
+		transport         string
+		dir               string
+		maxAttempts       int
+		pollInterval      time.Duration
+		dkimDomain        string
+		dkimSelector      string
+		dkimKeyFile       string
+		unsubscribeURL    string
+		unsubscribeSecret string
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	healthz struct {
+		checkSMTP    bool
+		smtpCacheTTL time.Duration
+	}
+	jobs struct {
+		workers      int
+		pollInterval time.Duration
+		timeout      time.Duration
+		maxAttempts  int
+	}
+	maintenance struct {
+		enabled             bool
+		tokensSchedule      string
+		usersSchedule       string
+		unactivatedUserDays int
+		importsSchedule     string
+		importRowsDays      int
+	}
+	shutdown struct {
+		delay             time.Duration
+		timeout           time.Duration
+		backgroundTimeout time.Duration
+	}
+	search struct {
+		suggestCacheTTL  time.Duration
+		suggestCacheSize int
+	}
+	stats struct {
+		cacheTTL  time.Duration
+		cacheSize int
+	}
+	imports struct {
+		maxBytes int64
+		maxRows  int
+	}
+	cors struct {
+		trustedOrigins   []string
+		allowCredentials bool
+		maxAge           time.Duration
+		exposedHeaders   []string
+		routePolicies    []corsPolicy
+	}
+}
+
+// limiterPolicy 定义一组路由共享的限流配额，没有匹配任何策略的请求使用 limiter.rps 和 limiter.burst
+type limiterPolicy struct {
+	name   string
+	limit  ratelimit.Limit
+	routes []string
+}
+
+// corsPolicy 为一组路由单独指定允许的来源，覆盖 cors.trustedOrigins
+type corsPolicy struct {
+	origins []string
+	routes  []string
+}
+
+// secretFlags 中的配置项还可以通过 <name>-file 从文件中读取，避免将密钥直接写在命令行或配置文件中
+var secretFlags = []string{"db-dsn", "smtp-username", "smtp-password", "mail-unsubscribe-secret"}
+
+// repeatableFlags 中的配置项可以指定多次，在配置文件中使用列表表示，在环境变量中使用 ; 分隔
+var repeatableFlags = []string{"limiter-policy", "cors-route-policy"}
+
+// configValue 表示配置文件或环境变量中的一个配置项，fromFile 为 true 时 values 是保存密钥的文件路径
+type configValue struct {
+	values   []string
+	fromFile bool
+}
+
+// loadConfig 按照 默认值 < 配置文件 < GREENLIGHT_* 环境变量 < 命令行参数 的优先级加载配置，并在返回之前校验配置
+func loadConfig(args []string) (*config, error) {
+	cfg := &config{}
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+
+	configFile := fs.String("config", os.Getenv("GREENLIGHT_CONFIG"), "Path to a YAML configuration file")
+
+	fs.IntVar(&cfg.port, "port", 4000, "API server port")
+	fs.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+
+	cfg.logLevel = jsonlog.LevelInfo
+	fs.Func("log-level", "Minimum log level (info|error|fatal|off)", func(val string) error {
+		level, err := jsonlog.ParseLevel(val)
+		if err != nil {
+			return err
+		}
+		cfg.logLevel = level
+		return nil
+	})
+
+	fs.Func("trusted-proxies", "Trusted reverse proxy CIDRs whose forwarding headers are honored (space separated)", func(val string) error {
+		cfg.trustedProxies = nil
+		for _, field := range strings.Fields(val) {
+			prefix, err := parseTrustedProxy(field)
+			if err != nil {
+				return err
+			}
+			cfg.trustedProxies = append(cfg.trustedProxies, prefix)
+		}
+		return nil
+	})
+
+	fs.StringVar(&cfg.tls.certFile, "tls-cert", "", "TLS certificate file (enables HTTPS)")
+	fs.StringVar(&cfg.tls.keyFile, "tls-key", "", "TLS private key file")
+	fs.IntVar(&cfg.tls.redirectPort, "tls-redirect-port", 0, "Port for a plain HTTP listener that redirects to HTTPS (0 to disable)")
+	fs.StringVar(&cfg.tls.publicHost, "tls-public-host", "", "Public HTTPS host used in redirects (defaults to the request host)")
+	fs.IntVar(&cfg.tls.publicPort, "tls-public-port", 443, "Public HTTPS port used in redirects, e.g. when port is behind a load balancer")
+	fs.StringVar(&cfg.tls.clientCA, "tls-client-ca", "", "CA bundle used to verify client certificates (enables mutual TLS)")
+	fs.StringVar(&cfg.tls.clientAuth, "tls-client-auth", "optional", "Client certificate policy when mutual TLS is enabled (optional|require)")
+
+	fs.DurationVar(&cfg.shutdown.delay, "shutdown-delay", 0, "Time to keep serving after readiness fails on shutdown")
+	fs.DurationVar(&cfg.shutdown.timeout, "shutdown-timeout", 5*time.Second, "Time allowed for in-flight HTTP requests to finish on shutdown")
+	fs.DurationVar(&cfg.shutdown.backgroundTimeout, "shutdown-background-timeout", 30*time.Second, "Time allowed for background tasks to finish on shutdown")
+
+	fs.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
+
+	fs.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+
+	fs.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum request per second")
+	fs.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	fs.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	fs.StringVar(&cfg.limiter.store, "limiter-store", "memory", "Rate limiter state store (memory|postgres)")
+	fs.Float64Var(&cfg.limiter.floodRPS, "limiter-flood-rps", 20, "Per-IP request rate allowed before authentication, for all routes together")
+	fs.IntVar(&cfg.limiter.floodBurst, "limiter-flood-burst", 100, "Per-IP burst allowed before authentication")
+
+	fs.Func("limiter-policy", `Rate limiter policy for a route group, e.g. "auth=0.2:5 POST:/v1/tokens/*" (repeatable)`, func(val string) error {
+		policy, err := parseLimiterPolicy(val)
+		if err != nil {
+			return err
+		}
+		cfg.limiter.policies = append(cfg.limiter.policies, policy)
+		return nil
+	})
+
+	fs.StringVar(&cfg.mail.transport, "mail-transport", "", "Mail transport (smtp|file|log|memory), defaults to log in development and smtp otherwise")
+	fs.StringVar(&cfg.mail.dir, "mail-dir", "./tmp/mail", "Directory for .eml files written by the file mail transport")
+	fs.IntVar(&cfg.mail.maxAttempts, "mail-max-attempts", 5, "Delivery attempts before an outbox email is marked failed")
+	fs.DurationVar(&cfg.mail.pollInterval, "mail-poll-interval", time.Second, "How often the idle outbox dispatcher polls for emails")
+	fs.StringVar(&cfg.mail.dkimDomain, "mail-dkim-domain", "", "DKIM signing domain (defaults to the domain of smtp-sender)")
+	fs.StringVar(&cfg.mail.dkimSelector, "mail-dkim-selector", "", "DKIM selector, enables signing together with mail-dkim-key-file")
+	fs.StringVar(&cfg.mail.dkimKeyFile, "mail-dkim-key-file", "", "PEM file with the RSA private key used for DKIM signing")
+	fs.StringVar(&cfg.mail.unsubscribeURL, "mail-unsubscribe-url", "", "Public URL of POST /v1/emails/unsubscribe, used in List-Unsubscribe headers")
+	fs.StringVar(&cfg.mail.unsubscribeSecret, "mail-unsubscribe-secret", "", "Secret used to sign unsubscribe links")
+
+	fs.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	fs.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	fs.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	fs.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	fs.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@github/Alphasxd>", "SMTP sender")
+
+	fs.IntVar(&cfg.jobs.workers, "jobs-workers", 2, "Number of background job workers")
+	fs.DurationVar(&cfg.jobs.pollInterval, "jobs-poll-interval", time.Second, "How often idle workers poll the job queue")
+	fs.DurationVar(&cfg.jobs.timeout, "jobs-timeout", time.Minute, "Maximum run time of a single job")
+	fs.IntVar(&cfg.jobs.maxAttempts, "jobs-max-attempts", 5, "Attempts before a job is moved to the dead state")
+
+	fs.BoolVar(&cfg.maintenance.enabled, "maintenance-enabled", true, "Run scheduled maintenance tasks")
+	fs.StringVar(&cfg.maintenance.tokensSchedule, "maintenance-tokens-schedule", "0 * * * *", "Cron schedule for purging expired tokens")
+	fs.StringVar(&cfg.maintenance.usersSchedule, "maintenance-users-schedule", "30 3 * * *", "Cron schedule for purging unactivated users")
+	fs.IntVar(&cfg.maintenance.unactivatedUserDays, "maintenance-unactivated-user-days", 30, "Delete users that are still not activated after this many days (0 to disable)")
+	fs.StringVar(&cfg.maintenance.importsSchedule, "maintenance-imports-schedule", "45 3 * * *", "Cron schedule for purging rows of finished movie imports")
+	fs.IntVar(&cfg.maintenance.importRowsDays, "maintenance-import-rows-days", 7, "Delete the failed rows of movie imports this many days after they finish (0 to disable)")
+
+	fs.BoolVar(&cfg.healthz.checkSMTP, "healthz-check-smtp", false, "Include the SMTP server in readiness checks")
+	fs.DurationVar(&cfg.healthz.smtpCacheTTL, "healthz-smtp-cache-ttl", 10*time.Second, "How long the result of the SMTP readiness check is reused")
+
+	fs.DurationVar(&cfg.search.suggestCacheTTL, "search-suggest-cache-ttl", 30*time.Second, "How long autocomplete suggestions are cached (0 to disable)")
+	fs.IntVar(&cfg.search.suggestCacheSize, "search-suggest-cache-size", 1000, "Maximum number of cached autocomplete queries")
+
+	fs.DurationVar(&cfg.stats.cacheTTL, "stats-cache-ttl", time.Minute, "How long catalogue statistics are cached per filter combination (0 to disable)")
+	fs.IntVar(&cfg.stats.cacheSize, "stats-cache-size", 500, "Maximum number of cached statistics queries")
+
+	fs.Int64Var(&cfg.imports.maxBytes, "import-max-bytes", 100<<20, "Maximum size in bytes of a movie import upload")
+	fs.IntVar(&cfg.imports.maxRows, "import-max-rows", 100_000, "Maximum number of rows in a movie import")
+
+	fs.Func("cors-trusted-origins", "Trusted CORS origins, e.g. https://*.example.com (space separated)", func(val string) error {
+		cfg.cors.trustedOrigins = strings.Fields(val)
+		return nil
+	})
+	fs.BoolVar(&cfg.cors.allowCredentials, "cors-allow-credentials", false, "Allow credentialed CORS requests")
+	fs.DurationVar(&cfg.cors.maxAge, "cors-max-age", 10*time.Minute, "CORS preflight cache duration")
+
+	cfg.cors.exposedHeaders = []string{"Location", "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}
+	fs.Func("cors-exposed-headers", "Response headers exposed to CORS requests (space separated)", func(val string) error {
+		cfg.cors.exposedHeaders = strings.Fields(val)
+		return nil
+	})
+
+	fs.Func("cors-route-policy", `CORS origins for a route group, e.g. "* GET:/v1/movies" or "- /v1/tokens/*" to deny (repeatable)`, func(val string) error {
+		policy, err := parseCORSPolicy(val)
+		if err != nil {
+			return err
+		}
+		cfg.cors.routePolicies = append(cfg.cors.routePolicies, policy)
+		return nil
+	})
+
+	// 为每个密钥配置项注册一个 <name>-file 参数，读取文件内容作为配置项的值
+	for _, name := range secretFlags {
+		name := name
+		fs.Func(name+"-file", fmt.Sprintf("Read %s from file", name), func(path string) error {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return fs.Set(name, strings.TrimRight(string(content), "\r\n"))
+		})
+	}
+
+	// 定义一个命令行参数，用于显示版本号
+	fs.BoolVar(&cfg.displayVersion, "version", false, "Display version and exit")
+
+	// 先解析命令行参数，这样才能知道哪些配置项已经在命令行中指定，配置文件和环境变量不能覆盖它们
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.displayVersion {
+		return cfg, nil
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	values := make(map[string]configValue)
+
+	if *configFile != "" {
+		err = readConfigFile(*configFile, values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 环境变量覆盖配置文件中的同名配置项
+	readConfigEnv(fs, values)
+
+	for name, value := range values {
+		if explicit[name] || explicit[name+"-file"] {
+			continue
+		}
+
+		target := name
+		if value.fromFile {
+			target = name + "-file"
+		}
+
+		if fs.Lookup(target) == nil || name == "config" || name == "version" {
+			return nil, fmt.Errorf("unknown configuration key %q", target)
+		}
+
+		for _, val := range value.values {
+			err = fs.Set(target, val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for configuration key %q: %w", target, err)
+			}
+		}
+	}
+
+	// 如果没有指定限流策略，则为登录和注册等认证相关的路由使用更严格的默认配额
+	if len(cfg.limiter.policies) == 0 {
+		cfg.limiter.policies = []limiterPolicy{
+			{
+				name:   "auth",
+				limit:  ratelimit.Limit{Rate: 0.2, Burst: 5},
+				routes: []string{"POST:/v1/tokens/*", "POST:/v1/users", "PUT:/v1/users/activated"},
+			},
+		}
+	}
+
+	// 开发环境默认不发送真实的邮件
+	if cfg.mail.transport == "" {
+		cfg.mail.transport = "smtp"
+		if cfg.env == "development" {
+			cfg.mail.transport = "log"
+		}
+	}
+
+	v := validator.New()
+	if validateConfig(v, cfg); !v.Valid() {
+		return nil, validationError(v)
+	}
+
+	return cfg, nil
+}
+
+// readConfigFile 读取 YAML 配置文件，嵌套的键使用 - 连接，与命令行参数的名称一致，
+// 例如 db: {max-open-conns: 25} 等价于 -db-max-open-conns=25
+func readConfigFile(path string, values map[string]configValue) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var doc map[string]any
+
+	err = yaml.Unmarshal(content, &doc)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	flattenConfig("", doc, values)
+
+	return nil
+}
+
+// flattenConfig 将嵌套的配置展开为 name -> values 的形式
+func flattenConfig(prefix string, doc map[string]any, values map[string]configValue) {
+	for key, val := range doc {
+		name := key
+		if prefix != "" {
+			name = prefix + "-" + key
+		}
+
+		switch val := val.(type) {
+		case nil:
+		case map[string]any:
+			flattenConfig(name, val, values)
+		case []any:
+			items := make([]string, 0, len(val))
+			for _, item := range val {
+				items = append(items, fmt.Sprint(item))
+			}
+			// 可重复的配置项每个元素设置一次，其它列表使用空格连接，与命令行参数的格式一致
+			if validator.In(name, repeatableFlags...) {
+				setConfigValue(values, name, items)
+			} else {
+				setConfigValue(values, name, []string{strings.Join(items, " ")})
+			}
+		default:
+			setConfigValue(values, name, []string{fmt.Sprint(val)})
+		}
+	}
+}
+
+// readConfigEnv 读取与命令行参数对应的 GREENLIGHT_* 环境变量，例如 -db-max-open-conns 对应 GREENLIGHT_DB_MAX_OPEN_CONNS
+func readConfigEnv(fs *flag.FlagSet, values map[string]configValue) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "version" {
+			return
+		}
+
+		env := "GREENLIGHT_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+
+		val, ok := os.LookupEnv(env)
+		if !ok {
+			return
+		}
+
+		if validator.In(f.Name, repeatableFlags...) {
+			setConfigValue(values, f.Name, strings.Split(val, ";"))
+		} else {
+			setConfigValue(values, f.Name, []string{val})
+		}
+	})
+}
+
+// setConfigValue 保存一个配置项，<name>-file 和 <name> 被视为同一个配置项，后设置的覆盖先设置的
+func setConfigValue(values map[string]configValue, name string, vals []string) {
+	if base, found := strings.CutSuffix(name, "-file"); found && validator.In(base, secretFlags...) {
+		values[base] = configValue{values: vals, fromFile: true}
+		return
+	}
+
+	values[name] = configValue{values: vals}
+}
+
+// validateConfig 检查配置是否有效。如果有错误，方法会将错误添加到 v.Errors 中。
+func validateConfig(v *validator.Validator, cfg *config) {
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be a valid TCP port")
+	v.Check(validator.In(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+
+	v.Check((cfg.tls.certFile == "") == (cfg.tls.keyFile == ""), "tls-cert", "must be provided together with tls-key")
+	v.Check(cfg.tls.redirectPort >= 0 && cfg.tls.redirectPort <= 65535, "tls-redirect-port", "must be a valid TCP port")
+	v.Check(cfg.tls.redirectPort == 0 || cfg.tls.certFile != "", "tls-redirect-port", "requires tls-cert and tls-key")
+	v.Check(cfg.tls.redirectPort == 0 || cfg.tls.redirectPort != cfg.port, "tls-redirect-port", "must be different from port")
+	v.Check(cfg.tls.publicHost == "" || validHost(cfg.tls.publicHost), "tls-public-host", "must be a host name without a scheme, port or path")
+	v.Check(cfg.tls.publicPort > 0 && cfg.tls.publicPort <= 65535, "tls-public-port", "must be a valid TCP port")
+	v.Check(cfg.tls.clientCA == "" || cfg.tls.certFile != "", "tls-client-ca", "requires tls-cert and tls-key")
+	v.Check(validator.In(cfg.tls.clientAuth, "optional", "require"), "tls-client-auth", "must be optional or require")
+
+	v.Check(cfg.shutdown.delay >= 0, "shutdown-delay", "must not be negative")
+	v.Check(cfg.shutdown.timeout > 0, "shutdown-timeout", "must be greater than zero")
+	v.Check(cfg.shutdown.backgroundTimeout > 0, "shutdown-background-timeout", "must be greater than zero")
+
+	v.Check(cfg.db.dsn != "", "db-dsn", "must be provided")
+	v.Check(cfg.db.maxOpenConns >= 0, "db-max-open-conns", "must not be negative")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+	_, err := time.ParseDuration(cfg.db.maxIdleTime)
+	v.Check(err == nil, "db-max-idle-time", "must be a valid duration")
+
+	v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+	v.Check(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+	v.Check(cfg.limiter.floodRPS > 0, "limiter-flood-rps", "must be greater than zero")
+	v.Check(cfg.limiter.floodBurst > 0, "limiter-flood-burst", "must be greater than zero")
+	v.Check(validator.In(cfg.limiter.store, "memory", "postgres"), "limiter-store", "must be memory or postgres")
+
+	v.Check(validator.In(cfg.mail.transport, "smtp", "file", "log", "memory"), "mail-transport", "must be smtp, file, log or memory")
+	v.Check(cfg.mail.transport != "file" || cfg.mail.dir != "", "mail-dir", "must be provided")
+	v.Check(cfg.mail.maxAttempts > 0, "mail-max-attempts", "must be greater than zero")
+	v.Check(cfg.mail.pollInterval > 0, "mail-poll-interval", "must be greater than zero")
+	v.Check((cfg.mail.dkimSelector == "") == (cfg.mail.dkimKeyFile == ""), "mail-dkim-selector", "must be provided together with mail-dkim-key-file")
+	if cfg.mail.unsubscribeURL != "" {
+		u, err := url.Parse(cfg.mail.unsubscribeURL)
+		v.Check(err == nil && u.IsAbs() && u.Host != "", "mail-unsubscribe-url", "must be an absolute URL")
+		v.Check(len(cfg.mail.unsubscribeSecret) >= 32, "mail-unsubscribe-secret", "must be at least 32 bytes long")
+	}
+
+	v.Check(cfg.smtp.host != "", "smtp-host", "must be provided")
+	v.Check(cfg.smtp.port > 0 && cfg.smtp.port <= 65535, "smtp-port", "must be a valid TCP port")
+	v.Check(cfg.smtp.sender != "", "smtp-sender", "must be provided")
+
+	v.Check(cfg.healthz.smtpCacheTTL >= 0, "healthz-smtp-cache-ttl", "must not be negative")
+
+	v.Check(cfg.jobs.workers >= 0, "jobs-workers", "must not be negative")
+	v.Check(cfg.jobs.pollInterval > 0, "jobs-poll-interval", "must be greater than zero")
+	v.Check(cfg.jobs.timeout > 0, "jobs-timeout", "must be greater than zero")
+	v.Check(cfg.jobs.maxAttempts > 0, "jobs-max-attempts", "must be greater than zero")
+
+	_, err = cron.Parse(cfg.maintenance.tokensSchedule)
+	v.Check(err == nil, "maintenance-tokens-schedule", "must be a valid cron expression")
+	_, err = cron.Parse(cfg.maintenance.usersSchedule)
+	v.Check(err == nil, "maintenance-users-schedule", "must be a valid cron expression")
+	v.Check(cfg.maintenance.unactivatedUserDays >= 0, "maintenance-unactivated-user-days", "must not be negative")
+	_, err = cron.Parse(cfg.maintenance.importsSchedule)
+	v.Check(err == nil, "maintenance-imports-schedule", "must be a valid cron expression")
+	v.Check(cfg.maintenance.importRowsDays >= 0, "maintenance-import-rows-days", "must not be negative")
+
+	v.Check(cfg.search.suggestCacheTTL >= 0, "search-suggest-cache-ttl", "must not be negative")
+	v.Check(cfg.search.suggestCacheSize > 0, "search-suggest-cache-size", "must be greater than zero")
+
+	v.Check(cfg.stats.cacheTTL >= 0, "stats-cache-ttl", "must not be negative")
+	v.Check(cfg.stats.cacheSize > 0, "stats-cache-size", "must be greater than zero")
+
+	v.Check(cfg.imports.maxBytes > 0, "import-max-bytes", "must be greater than zero")
+	v.Check(cfg.imports.maxRows > 0, "import-max-rows", "must be greater than zero")
+
+	v.Check(cfg.cors.maxAge >= 0, "cors-max-age", "must not be negative")
+	// 允许携带凭证时，任意来源都可以读取用户的数据，这几乎总是配置错误
+	v.Check(!cfg.cors.allowCredentials || !validator.In("*", cfg.cors.trustedOrigins...), "cors-trusted-origins", "must not contain * when credentials are allowed")
+	for _, policy := range cfg.cors.routePolicies {
+		v.Check(!cfg.cors.allowCredentials || !validator.In("*", policy.origins...), "cors-route-policy", "must not contain * when credentials are allowed")
+	}
+}
+
+// validationError 将校验错误合并为一个按配置项排序的错误
+func validationError(v *validator.Validator) error {
+	keys := make([]string, 0, len(v.Errors))
+	for key := range v.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		msgs = append(msgs, key+" "+v.Errors[key])
+	}
+
+	return fmt.Errorf("invalid configuration: %s", strings.Join(msgs, "; "))
+}
+
+// reloadConfig 重新加载配置，并应用其中可以在运行时安全修改的部分：限流配额、CORS 策略、搜索建议和统计数据的缓存时间以及日志级别。
+// 其它配置项（例如端口和数据库）的修改需要重启才能生效。
+func (app *application) reloadConfig() error {
+	next, err := loadConfig(os.Args[1:])
+	if err != nil {
+		return err
+	}
+
+	cfg := *app.config.Load()
+	cfg.logLevel = next.logLevel
+	cfg.limiter.rps = next.limiter.rps
+	cfg.limiter.burst = next.limiter.burst
+	cfg.limiter.enabled = next.limiter.enabled
+	cfg.limiter.policies = next.limiter.policies
+	cfg.limiter.floodRPS = next.limiter.floodRPS
+	cfg.limiter.floodBurst = next.limiter.floodBurst
+	cfg.cors = next.cors
+	cfg.search.suggestCacheTTL = next.search.suggestCacheTTL
+	cfg.stats.cacheTTL = next.stats.cacheTTL
+
+	app.config.Store(&cfg)
+	app.logger.SetLevel(cfg.logLevel)
+
+	return nil
+}
+
+// parseCORSPolicy 解析形如 "origin,origin... route route..." 的路由 CORS 策略，
+// origin 为 "-" 表示不允许任何跨域请求
+func parseCORSPolicy(val string) (corsPolicy, error) {
+	fields := strings.Fields(val)
+	if len(fields) < 2 {
+		return corsPolicy{}, errors.New("cors route policy must contain origins and at least one route")
+	}
+
+	var origins []string
+	if fields[0] != "-" {
+		origins = strings.Split(fields[0], ",")
+	}
+
+	for _, route := range fields[1:] {
+		if _, _, ok := splitRoutePattern(route); !ok {
+			return corsPolicy{}, fmt.Errorf("invalid cors route policy route %q", route)
+		}
+	}
+
+	return corsPolicy{origins: origins, routes: fields[1:]}, nil
+}
+
+// parseTrustedProxy 解析一个 CIDR，单独的 IP 地址会被当作只包含它自己的网段
+func parseTrustedProxy(val string) (netip.Prefix, error) {
+	if !strings.Contains(val, "/") {
+		addr, err := netip.ParseAddr(val)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q", val)
+		}
+		return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(val)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid trusted proxy %q", val)
+	}
+	return prefix.Masked(), nil
+}
+
+// parseLimiterPolicy 解析形如 "name=rps:burst route route..." 的限流策略，
+// 其中 route 的格式为 "METHOD:/path" 或 "/path"，详见 routeMatches()
+func parseLimiterPolicy(val string) (limiterPolicy, error) {
+	fields := strings.Fields(val)
+	if len(fields) < 2 {
+		return limiterPolicy{}, errors.New("limiter policy must contain a budget and at least one route")
+	}
+
+	name, budget, ok := strings.Cut(fields[0], "=")
+	if !ok || name == "" {
+		return limiterPolicy{}, fmt.Errorf("invalid limiter policy budget %q", fields[0])
+	}
+
+	rps, burst, ok := strings.Cut(budget, ":")
+	if !ok {
+		return limiterPolicy{}, fmt.Errorf("invalid limiter policy budget %q", fields[0])
+	}
+
+	limit := ratelimit.Limit{}
+
+	var err error
+	limit.Rate, err = strconv.ParseFloat(rps, 64)
+	if err != nil || limit.Rate <= 0 {
+		return limiterPolicy{}, fmt.Errorf("invalid limiter policy rps %q", rps)
+	}
+
+	limit.Burst, err = strconv.Atoi(burst)
+	if err != nil || limit.Burst <= 0 {
+		return limiterPolicy{}, fmt.Errorf("invalid limiter policy burst %q", burst)
+	}
+
+	for _, route := range fields[1:] {
+		if _, _, ok := splitRoutePattern(route); !ok {
+			return limiterPolicy{}, fmt.Errorf("invalid limiter policy route %q", route)
+		}
+	}
+
+	return limiterPolicy{name: name, limit: limit, routes: fields[1:]}, nil
+}
+
+// validHost 检查 host 是否是一个不带协议、端口和路径的主机名
+func validHost(host string) bool {
+	u, err := url.Parse("https://" + host)
+	return err == nil && u.Host == host && u.Port() == "" && u.User == nil && u.Path == ""
+}
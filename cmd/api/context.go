@@ -9,7 +9,10 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey     = contextKey("user")
+	clientIPContextKey = contextKey("clientIP")
+)
 
 // contextSetUser 将给定的 User 对象添加到请求的上下文中
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
@@ -25,3 +28,18 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// contextSetClientIP 将解析出的客户端 IP 地址添加到请求的上下文中
+func (app *application) contextSetClientIP(r *http.Request, ip string) *http.Request {
+	ctx := context.WithValue(r.Context(), clientIPContextKey, ip)
+	return r.WithContext(ctx)
+}
+
+// contextGetClientIP 从请求的上下文中返回客户端 IP 地址
+func (app *application) contextGetClientIP(r *http.Request) string {
+	ip, ok := r.Context().Value(clientIPContextKey).(string)
+	if !ok {
+		panic("missing client ip value in request context")
+	}
+	return ip
+}
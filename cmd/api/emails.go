@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/Alphasxd/greenlight/internal/data"
+	"github.com/Alphasxd/greenlight/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// listUserEmailsHandler 返回发送给指定用户的邮件及其投递状态
+func (app *application) listUserEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Status = app.readString(qs, "status", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+	input.Filters.SortSafelist = []string{"id", "created_at", "updated_at", "-id", "-created_at", "-updated_at"}
+
+	data.ValidateEmailStatus(v, input.Status)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 区分用户不存在和用户没有任何邮件两种情况
+	_, err = app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	emails, metadata, err := app.models.Emails.GetAllForUser(id, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"emails": emails, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// emailPreviewData 是预览邮件模板时使用的示例数据
+var emailPreviewData = map[string]map[string]any{
+	"user_welcome.tmpl": {
+		"activationToken": "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU",
+		"userID":          123,
+	},
+}
+
+// listEmailTemplatesHandler 返回所有邮件模板的文件名，只在开发环境中可用
+func (app *application) listEmailTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"templates": app.mailer.Templates()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// previewEmailHandler 使用示例数据渲染一个邮件模板，只在开发环境中可用。
+// format 为 html 或 text 时直接返回对应的正文，方便在浏览器中查看，否则以 JSON 返回主题和两种正文。
+func (app *application) previewEmailHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	templateFile := params.ByName("template")
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	locale := app.readString(qs, "locale", "en")
+	format := app.readString(qs, "format", "json")
+
+	data.ValidateLocale(v, locale)
+	v.Check(validator.In(format, "json", "html", "text"), "format", "must be json, html or text")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !strings.HasSuffix(templateFile, ".tmpl") {
+		templateFile += ".tmpl"
+	}
+
+	msg, err := app.mailer.Render(templateFile, locale, emailPreviewData[templateFile])
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	switch format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(msg.HTMLBody))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(msg.Subject + "\n" + msg.PlainBody))
+	default:
+		preview := map[string]string{
+			"subject":    msg.Subject,
+			"plain_body": msg.PlainBody,
+			"html_body":  msg.HTMLBody,
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"email": preview}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+// senderDomain 返回发件人地址的域名，例如 "Greenlight <no-reply@example.com>" 返回 example.com
+func senderDomain(sender string) string {
+	addr, err := mail.ParseAddress(sender)
+	if err != nil {
+		return ""
+	}
+
+	_, domain, _ := strings.Cut(addr.Address, "@")
+	return domain
+}
+
+// unsubscribeToken 使用 secret 为收件人地址计算 HMAC，退订链接通过它证明自己是发给这个地址的
+func unsubscribeToken(secret, email string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.ToLower(email)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// unsubscribeURL 返回收件人的一键退订地址
+func unsubscribeURL(base, secret, email string) string {
+	qs := url.Values{}
+	qs.Set("email", email)
+	qs.Set("token", unsubscribeToken(secret, email))
+
+	return base + "?" + qs.Encode()
+}
+
+// unsubscribeHandler 处理 List-Unsubscribe 头部中的一键退订请求（RFC 8058），将地址以 unsubscribed 的原因加入禁止发送名单。
+// 请求不需要登录，而是通过 token 验证地址；退订只会停止非事务性邮件。
+func (app *application) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := app.config.Load()
+
+	qs := r.URL.Query()
+	email := app.readString(qs, "email", "")
+	token := app.readString(qs, "token", "")
+
+	v := validator.New()
+
+	data.ValidateEmail(v, email)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 没有配置退订地址时不接受退订请求，避免在没有密钥的情况下伪造 token
+	expected := unsubscribeToken(cfg.mail.unsubscribeSecret, email)
+	if cfg.mail.unsubscribeSecret == "" || !hmac.Equal([]byte(token), []byte(expected)) {
+		v.AddError("token", "invalid unsubscribe token")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suppression := &data.EmailSuppression{
+		Email:  email,
+		Reason: data.SuppressionUnsubscribed,
+	}
+
+	err := app.models.Suppression.Insert(suppression)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been unsubscribed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Reason string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Reason = app.readString(qs, "reason", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"email", "created_at", "-email", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suppressions, metadata, err := app.models.Suppression.GetAll(input.Reason, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suppressions": suppressions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email  string `json:"email"`
+		Reason string `json:"reason"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	suppression := &data.EmailSuppression{
+		Email:  input.Email,
+		Reason: input.Reason,
+	}
+
+	// 没有指定原因时视为管理员手动添加
+	if suppression.Reason == "" {
+		suppression.Reason = data.SuppressionManual
+	}
+
+	v := validator.New()
+
+	if data.ValidateSuppression(v, suppression); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 管理员明确指定的原因覆盖已有的原因，地址已经存在时返回 200
+	created, err := app.models.Suppression.Set(suppression)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, status, envelope{"suppression": suppression}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	email := httprouter.ParamsFromContext(r.Context()).ByName("email")
+
+	err := app.models.Suppression.Delete(email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "address successfully removed from the suppression list"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 // 记录错误日志
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
+		"client_ip":      app.contextGetClientIP(r),
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
 	})
@@ -79,6 +80,12 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, msg)
 }
 
+// 向客户端发送 401 错误响应和 JSON 格式 Response, 客户端证书没有对应的用户
+func (app *application) invalidClientCertificateResponse(w http.ResponseWriter, r *http.Request) {
+	msg := "the client certificate is not associated with any user account"
+	app.errorResponse(w, r, http.StatusUnauthorized, msg)
+}
+
 // 向客户端发送 401 错误响应和 JSON 格式 Response, 用户未通过身份验证，需要登录
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	msg := "you must be authenticated to access this resource"
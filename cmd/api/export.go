@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/data"
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// exportFlushRows 是导出时每写入多少部电影刷新一次响应，客户端可以边下载边处理
+const exportFlushRows = 500
+
+// exportContentTypes 是每种导出格式对应的 Content-Type
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"json":   "application/json",
+}
+
+// exportMovie 是导出的电影，runtime_format=minutes 时用 Runtime 覆盖 data.Movie 中 "N mins" 格式的时长
+type exportMovie struct {
+	*data.Movie
+	Runtime int32 `json:"runtime,omitempty"`
+}
+
+// movieExporter 将电影以指定的格式写入响应，第一次写入时才发送响应头，
+// 这样在写入任何数据之前发生的错误仍然可以作为普通的错误响应发送
+type movieExporter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	buf     *bufio.Writer
+	csv     *csv.Writer
+	format  string
+	minutes bool
+	started bool
+	count   int
+}
+
+func (e *movieExporter) start() error {
+	e.w.Header().Set("Content-Type", exportContentTypes[e.format])
+	e.w.Header().Set("Content-Disposition", `attachment; filename="movies.`+e.format+`"`)
+	e.w.WriteHeader(http.StatusOK)
+	e.started = true
+
+	switch e.format {
+	case "csv":
+		return e.csv.Write([]string{"id", "title", "year", "runtime", "genres", "rating", "rating_count", "version"})
+	case "json":
+		_, err := e.buf.WriteString(`{"movies":[`)
+		return err
+	}
+
+	return nil
+}
+
+func (e *movieExporter) write(movie *data.Movie) error {
+	if !e.started {
+		err := e.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch e.format {
+	case "csv":
+		runtime := strconv.Itoa(int(movie.Runtime))
+		if !e.minutes {
+			runtime += " mins"
+		}
+
+		err = e.csv.Write([]string{
+			strconv.FormatInt(movie.ID, 10),
+			movie.Title,
+			strconv.Itoa(int(movie.Year)),
+			runtime,
+			strings.Join(movie.Genres, ","),
+			strconv.FormatFloat(movie.Rating, 'f', -1, 64),
+			strconv.Itoa(int(movie.RatingCount)),
+			strconv.Itoa(int(movie.Version)),
+		})
+	default:
+		err = e.writeJSON(movie)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.count++
+	if e.count%exportFlushRows == 0 {
+		return e.flush()
+	}
+
+	return nil
+}
+
+// writeJSON 写入一部电影的 JSON 表示，json 格式中电影之间用逗号分隔，ndjson 格式中每部电影占一行
+func (e *movieExporter) writeJSON(movie *data.Movie) error {
+	var value any = movie
+	if e.minutes {
+		value = exportMovie{Movie: movie, Runtime: int32(movie.Runtime)}
+	}
+
+	js, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if e.format == "json" && e.count > 0 {
+		js = append([]byte{','}, js...)
+	}
+	if e.format == "ndjson" {
+		js = append(js, '\n')
+	}
+
+	_, err = e.buf.Write(js)
+	return err
+}
+
+// finish 写入剩余的内容并刷新响应，没有符合条件的电影时也会发送响应头
+func (e *movieExporter) finish() error {
+	if !e.started {
+		err := e.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.format == "json" {
+		_, err := e.buf.WriteString("]}\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.flush()
+}
+
+// flush 将缓冲区中的内容写入连接并发送给客户端
+func (e *movieExporter) flush() error {
+	e.csv.Flush()
+	if err := e.csv.Error(); err != nil {
+		return err
+	}
+
+	err := e.buf.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = e.rc.Flush()
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	return nil
+}
+
+// exportMoviesHandler 处理 GET /v1/movie-exports，以 CSV、NDJSON 或 JSON 格式导出所有符合筛选条件的电影。
+// 筛选条件与 listMoviesHandler 相同，但是没有分页，电影通过数据库游标逐批读取并写入响应，
+// 所以内存占用与电影的数量无关。runtime_format=minutes 时时长导出为分钟数，默认为 "N mins" 格式。
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.MovieFilters
+		Format        string
+		RuntimeFormat string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	input.Format = app.readString(qs, "format", "json")
+	input.RuntimeFormat = app.readString(qs, "runtime_format", "text")
+
+	v.Check(validator.In(input.Format, "csv", "ndjson", "json"), "format", "must be one of csv, ndjson or json")
+	v.Check(validator.In(input.RuntimeFormat, "text", "minutes"), "runtime_format", "must be text or minutes")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	// 导出所有电影可能超过服务器的 WriteTimeout，所以取消这个响应的写入超时，
+	// 客户端断开连接时 r.Context() 会被取消，从而停止读取
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	buf := bufio.NewWriter(w)
+
+	exporter := &movieExporter{
+		w:       w,
+		rc:      rc,
+		buf:     buf,
+		csv:     csv.NewWriter(buf),
+		format:  input.Format,
+		minutes: input.RuntimeFormat == "minutes",
+	}
+
+	err = app.models.Transact(func(tx data.Models) error {
+		return tx.Movies.Export(r.Context(), input.MovieFilters, exporter.write)
+	})
+	if err == nil {
+		err = exporter.finish()
+	}
+
+	if err != nil {
+		switch {
+		// 客户端已经断开连接，不需要发送任何内容
+		case errors.Is(err, context.Canceled):
+		// 还没有写入任何内容时仍然可以发送错误响应，否则只能中断响应，客户端会收到不完整的内容
+		case !exporter.started:
+			app.serverErrorResponse(w, r, err)
+		default:
+			app.logError(r, err)
+		}
+	}
+}
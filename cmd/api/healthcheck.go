@@ -1,15 +1,39 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// cachedCheck 缓存一项依赖检查的结果，零值可以直接使用
+type cachedCheck struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// run 在上一次检查超过 ttl 之后才重新执行 check，否则返回上一次的结果。
+// 检查期间持有锁，所以并发的请求会等待同一次检查，而不是同时连接依赖。
+func (c *cachedCheck) run(ttl time.Duration, check func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.checkedAt.IsZero() || time.Since(c.checkedAt) >= ttl {
+		c.err = check()
+		c.checkedAt = time.Now()
+	}
+
+	return c.err
+}
+
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	// 创建 map 用于存储当前应用的状态
 	env := envelope{
 		"status": "available",
 		"system_info": map[string]string{
-			"environment": app.config.env,
+			"environment": app.config.Load().env,
 			"version":     version,
 		},
 	}
@@ -19,3 +43,59 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// livenessHandler 只要进程能够处理请求就返回 200，不检查任何依赖
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readinessHandler 检查数据库（以及可选的 SMTP 服务器）是否可用，服务器正在关闭或者任何依赖不可用时返回 503
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	ready := !app.shuttingDown.Load()
+
+	checks := map[string]string{}
+
+	// 使用带超时的上下文检查数据库连接池
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	checks["database"] = "up"
+	err := app.db.PingContext(ctx)
+	if err != nil {
+		checks["database"] = "down"
+		ready = false
+		app.logError(r, err)
+	}
+
+	if cfg := app.config.Load(); cfg.healthz.checkSMTP {
+		checks["smtp"] = "up"
+		// 就绪检查是公开的，每次都连接 SMTP 服务器会给它带来不必要的负载，所以在一段时间内复用检查结果
+		err := app.smtpCheck.run(cfg.healthz.smtpCacheTTL, app.mailer.Ping)
+		if err != nil {
+			checks["smtp"] = "down"
+			ready = false
+			app.logError(r, err)
+		}
+	}
+
+	status := http.StatusOK
+	env := envelope{
+		"status":           "ready",
+		"shutting_down":    app.shuttingDown.Load(),
+		"checks":           checks,
+		"background_tasks": app.backgroundTasks.Load(),
+	}
+
+	if !ready {
+		status = http.StatusServiceUnavailable
+		env["status"] = "unavailable"
+	}
+
+	err = app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
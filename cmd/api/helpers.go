@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Alphasxd/greenlight/internal/validator"
 
@@ -20,11 +21,16 @@ type envelope map[string]any
 
 // readIDParam() 读取 URL 中的 id 参数
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam() 读取 URL 中名为 name 的 ID 参数，用于 /v1/movies/:id/reviews/:review_id 这样包含多个 ID 的路由
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -66,6 +72,122 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readInt32() 与 readInt() 相同，但是超出 int32 范围的值也视为无效，而不是在转换时回绕成另一个值
+func (app *application) readInt32(qs url.Values, key string, defaultValue int32, v *validator.Validator) int32 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		v.AddError(key, "must be an integer value between -2147483648 and 2147483647")
+		return defaultValue
+	}
+
+	return int32(i)
+}
+
+// readBool() 从 URL 查询字符串参数中读取布尔值，如果参数不存在或者无法解析为布尔值，则返回默认值
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readTime() 从 URL 查询字符串参数中读取时间，支持 RFC 3339 格式和 YYYY-MM-DD 格式的日期，如果参数不存在，则返回默认值
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t
+		}
+	}
+
+	v.AddError(key, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	return defaultValue
+}
+
+// splitRoutePattern() 将 "METHOD:/path" 或 "/path" 形式的路由模式拆分为请求方法和路径，方法为空时匹配任意方法
+func splitRoutePattern(pattern string) (method, path string, ok bool) {
+	if strings.HasPrefix(pattern, "/") {
+		return "", pattern, true
+	}
+
+	method, path, ok = strings.Cut(pattern, ":")
+	if !ok || method == "" || !strings.HasPrefix(path, "/") {
+		return "", "", false
+	}
+
+	return strings.ToUpper(method), path, true
+}
+
+// routeMatches() 检查请求方法和路径是否匹配给定的路由模式。
+// 路径中以 : 开头的段匹配任意一个非空路径段，结尾的 * 匹配任意后缀
+func routeMatches(pattern, method, path string) bool {
+	patternMethod, patternPath, ok := splitRoutePattern(pattern)
+	if !ok || (patternMethod != "" && patternMethod != method) {
+		return false
+	}
+
+	prefix, wildcard := strings.CutSuffix(patternPath, "*")
+	patternParts := strings.Split(prefix, "/")
+	pathParts := strings.Split(path, "/")
+
+	if len(pathParts) < len(patternParts) || (!wildcard && len(pathParts) != len(patternParts)) {
+		return false
+	}
+
+	for i, part := range patternParts {
+		last := wildcard && i == len(patternParts)-1
+
+		switch {
+		case strings.HasPrefix(part, ":") && pathParts[i] != "":
+		case last && strings.HasPrefix(pathParts[i], part):
+		case part == pathParts[i]:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// originMatches() 检查请求的 Origin 是否匹配给定的模式。
+// 模式 "*" 匹配任意来源，"https://*.example.com" 匹配 example.com 的任意子域名（不包括 example.com 本身）
+func originMatches(pattern, origin string) bool {
+	if pattern == "*" || pattern == origin {
+		return true
+	}
+
+	scheme, domain, ok := strings.Cut(pattern, "*.")
+	if !ok || !strings.HasPrefix(origin, scheme) {
+		return false
+	}
+
+	subdomain, found := strings.CutSuffix(strings.TrimPrefix(origin, scheme), "."+domain)
+	return found && subdomain != "" && !strings.ContainsAny(subdomain, "/:@")
+}
+
+// ceilSeconds() 将时间间隔向上取整为秒数，用于 RateLimit-Reset 和 Retry-After 等响应头
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
 // writeJSON() 写入 JSON 响应
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	// 将 data 封装成 JSON 格式
@@ -153,22 +275,3 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 
 	return nil
 }
-
-// background() 将一个函数作为 goroutine 在后台运行
-func (app *application) background(fn func()) {
-	// 增加 WaitGroup 的计数器
-	app.wg.Add(1)
-
-	go func() {
-		// 函数退出时，将 WaitGroup 的计数器减一
-		defer app.wg.Done()
-		// recover() 函数用于恢复 panic() 函数引起的 panic，防止程序崩溃
-		defer func() {
-			if err := recover(); err != nil {
-				app.logger.PrintError(fmt.Errorf("%s", err), nil)
-			}
-		}()
-		// 调用 fn() 函数
-		fn()
-	}()
-}
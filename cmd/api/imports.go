@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/data"
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// 上传时每次写入数据库的行数，以及后台任务每个事务处理的行数
+const (
+	importUploadBatchSize  = 500
+	importProcessBatchSize = 100
+)
+
+// errTooManyImportRows 表示上传的文件超过了 import-max-rows 行
+var errTooManyImportRows = errors.New("too many rows")
+
+// importReader 逐行读取上传的文件，每次返回一行的 JSON 表示，读完时返回 io.EOF
+type importReader interface {
+	next() (json.RawMessage, error)
+}
+
+// csvImportReader 读取 CSV 文件，第一行是列名，之后的每一行转换为以列名为键的 JSON 对象
+type csvImportReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+// newCSVImportReader 读取并规范化 CSV 文件的标题行，标题行无效时 v 中包含错误
+func newCSVImportReader(r io.Reader, v *validator.Validator) (*csvImportReader, error) {
+	reader := csv.NewReader(r)
+	// 列数不一致的行不应该导致整个文件失败，而是作为这一行的错误报告
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			v.AddError("header", "must be provided")
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for i, column := range header {
+		// Excel 导出的 UTF-8 文件以 BOM 开头
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+	}
+
+	data.ValidateImportHeader(v, header)
+
+	return &csvImportReader{reader: reader, header: header}, nil
+}
+
+func (cr *csvImportReader) next() (json.RawMessage, error) {
+	record, err := cr.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// 列数与标题行不一致时保存为数组，处理时报告为这一行的错误
+	if len(record) != len(cr.header) {
+		return json.Marshal(record)
+	}
+
+	fields := make(map[string]string, len(record))
+	for i, column := range cr.header {
+		fields[column] = record[i]
+	}
+
+	return json.Marshal(fields)
+}
+
+// ndjsonImportReader 读取 NDJSON 文件，每一行是一个 JSON 对象，空行会被忽略
+type ndjsonImportReader struct {
+	reader *bufio.Reader
+}
+
+func (nr *ndjsonImportReader) next() (json.RawMessage, error) {
+	for {
+		line, err := nr.reader.ReadBytes('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+			return nil, err
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		// 不是有效 JSON 的行保存为 JSON 字符串，处理时报告为这一行的错误
+		if !json.Valid(line) {
+			return json.Marshal(string(line))
+		}
+
+		return json.RawMessage(line), nil
+	}
+}
+
+// importFormat 从 format 查询参数或者 Content-Type 请求头中获取上传文件的格式
+func importFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return data.ImportCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return data.ImportNDJSON
+	default:
+		return ""
+	}
+}
+
+// importMoviesHandler 处理 POST /v1/imports，以流的方式读取 CSV 或 NDJSON 格式的请求体并保存每一行，
+// 然后创建一个后台任务逐批校验和导入。请求体不经过 readJSON，大小由 import-max-bytes 限制。
+// 查询参数 dry_run=true 时只校验每一行并统计将要创建和更新的电影数量，不修改任何电影。
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := app.config.Load()
+
+	v := validator.New()
+
+	format := importFormat(r)
+	dryRun := app.readBool(r.URL.Query(), "dry_run", false, v)
+
+	v.Check(validator.In(format, data.ImportCSV, data.ImportNDJSON), "format", "must be csv or ndjson, either as the format parameter or the Content-Type header")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 上传大文件可能超过服务器的 ReadTimeout，所以取消这个请求的读取超时，请求体的大小仍然由 import-max-bytes 限制
+	err := http.NewResponseController(w).SetReadDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.imports.maxBytes)
+
+	var reader importReader
+	switch format {
+	case data.ImportCSV:
+		csvReader, err := newCSVImportReader(r.Body, v)
+		if err != nil {
+			app.importUploadErrorResponse(w, r, err)
+			return
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		reader = csvReader
+	case data.ImportNDJSON:
+		reader = &ndjsonImportReader{reader: bufio.NewReader(r.Body)}
+	}
+
+	imp := &data.MovieImport{
+		UserID: app.contextGetUser(r).ID,
+		Format: format,
+		DryRun: dryRun,
+	}
+
+	err = app.models.Imports.Insert(imp)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	totalRows, err := app.uploadImportRows(imp, reader, cfg.imports.maxRows)
+	if err == nil && totalRows == 0 {
+		v.AddError("body", "must contain at least one row")
+	}
+
+	if err == nil && v.Valid() {
+		err = app.models.Transact(func(tx data.Models) error {
+			err := tx.Imports.Start(imp, totalRows)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Jobs.Enqueue(data.JobMovieImport, data.MovieImportPayload{ImportID: imp.ID}, cfg.jobs.maxAttempts)
+			return err
+		})
+	}
+
+	// 上传失败时删除已经保存的行，不留下无法完成的导入
+	if err != nil || !v.Valid() {
+		deleteErr := app.models.Imports.Delete(imp.ID)
+		if deleteErr != nil {
+			app.logError(r, deleteErr)
+		}
+
+		if err != nil {
+			app.importUploadErrorResponse(w, r, err)
+		} else {
+			app.failedValidationResponse(w, r, v.Errors)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/imports/%d", imp.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"import": imp}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadImportRows 从 reader 中读取所有的行，每 importUploadBatchSize 行写入一次数据库，返回总行数
+func (app *application) uploadImportRows(imp *data.MovieImport, reader importReader, maxRows int) (int, error) {
+	batch := make([]*data.ImportRow, 0, importUploadBatchSize)
+	total := 0
+
+	for {
+		row, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		total++
+		if total > maxRows {
+			return 0, errTooManyImportRows
+		}
+
+		batch = append(batch, &data.ImportRow{Number: total, Data: row})
+
+		if len(batch) == importUploadBatchSize {
+			err = app.models.Imports.InsertRows(imp.ID, batch)
+			if err != nil {
+				return 0, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		err := app.models.Imports.InsertRows(imp.ID, batch)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
+
+// importUploadErrorResponse 根据上传过程中的错误类型发送对应的错误响应
+func (app *application) importUploadErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+	var parseError *csv.ParseError
+
+	switch {
+	case errors.As(err, &maxBytesError):
+		message := fmt.Sprintf("body must not be larger than %d bytes", maxBytesError.Limit)
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+	case errors.Is(err, errTooManyImportRows):
+		message := fmt.Sprintf("body must not contain more than %d rows", app.config.Load().imports.maxRows)
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+	case errors.As(err, &parseError):
+		app.badRequestResponse(w, r, fmt.Errorf("body contains malformed CSV: %w", parseError))
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showImportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	imp, err := app.models.Imports.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"import": imp}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listImportErrorsHandler 返回导入中校验失败的行，每一行包括原始数据和每个字段的错误
+func (app *application) listImportErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "row_number")
+	input.Filters.SortSafelist = []string{"row_number", "-row_number"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	imp, err := app.models.Imports.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	rows, metadata, err := app.models.Imports.GetErrors(imp.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"errors": rows, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieImportJob 逐批处理一次导入中的行。每一批在一个事务中导入并记录进度，任务重试时从上次的进度继续。
+// 最后一次尝试仍然失败时，导入被标记为 failed。
+func (app *application) movieImportJob(ctx context.Context, job *data.Job) error {
+	var payload data.MovieImportPayload
+
+	err := json.Unmarshal(job.Payload, &payload)
+	if err != nil {
+		return err
+	}
+
+	imp, err := app.models.Imports.Get(payload.ImportID)
+	if err != nil {
+		// 导入已经被删除，没有需要处理的行
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if imp.Status == data.ImportCompleted || imp.Status == data.ImportFailed {
+		return nil
+	}
+
+	err = app.processImport(ctx, imp)
+	if err != nil && job.Attempts >= job.MaxAttempts {
+		finishErr := app.models.Imports.Finish(imp, data.ImportFailed, err.Error())
+		if finishErr != nil {
+			app.logger.PrintError(finishErr, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+		}
+	}
+
+	return err
+}
+
+// processImport 处理导入中剩余的行。为了不超过任务的超时时间，每个任务最多运行超时时间的一半，
+// 剩余的行由一个新的任务继续处理。
+func (app *application) processImport(ctx context.Context, imp *data.MovieImport) error {
+	deadline := time.Now().Add(app.config.Load().jobs.timeout / 2)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rows, err := app.models.Imports.NextRows(imp, importProcessBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(rows) == 0 {
+			return app.models.Imports.Finish(imp, data.ImportCompleted, "")
+		}
+
+		err = app.models.Transact(func(tx data.Models) error {
+			return importBatch(tx, imp, rows)
+		})
+		if err != nil {
+			return err
+		}
+
+		if time.Now().After(deadline) {
+			return app.enqueueJob(data.JobMovieImport, data.MovieImportPayload{ImportID: imp.ID})
+		}
+	}
+}
+
+// importBatch 校验并导入一批行，然后记录这一批的结果。无效的行不会影响同一批中的其它行。
+// 试运行时，同一个文件中重复的 external_id 只有第一次计为创建，之后计为更新，与实际导入的结果一致。
+func importBatch(tx data.Models, imp *data.MovieImport, rows []*data.ImportRow) error {
+	var created, updated int
+	var failed []*data.ImportRow
+
+	// 这一批中已经出现过的 external_id，之前的批次由 ExternalIDSeen 检查
+	seen := make(map[string]bool)
+
+	for _, row := range rows {
+		v := validator.New()
+
+		movie, externalID := data.DecodeImportRow(v, imp.Format, row.Data)
+		if !v.Valid() {
+			row.Errors = v.Errors
+			failed = append(failed, row)
+			continue
+		}
+
+		if imp.DryRun {
+			exists := seen[externalID]
+			if externalID != "" {
+				seen[externalID] = true
+			}
+
+			var err error
+			if !exists {
+				exists, err = tx.Imports.ExternalIDSeen(imp.ID, rows[0].Number, externalID)
+				if err != nil {
+					return err
+				}
+			}
+			if !exists {
+				exists, err = tx.Movies.ExternalIDExists(externalID)
+				if err != nil {
+					return err
+				}
+			}
+
+			if exists {
+				updated++
+			} else {
+				created++
+			}
+			continue
+		}
+
+		isNew, err := tx.Movies.Upsert(movie, externalID)
+		if err != nil {
+			return err
+		}
+
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
+	}
+
+	return tx.Imports.RecordBatch(imp, rows[len(rows)-1].Number, created, updated, failed)
+}
@@ -3,18 +3,21 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Alphasxd/greenlight/internal/cache"
 	"github.com/Alphasxd/greenlight/internal/data"
 	"github.com/Alphasxd/greenlight/internal/jsonlog"
 	"github.com/Alphasxd/greenlight/internal/mailer"
+	"github.com/Alphasxd/greenlight/internal/ratelimit"
 
 	_ "github.com/lib/pq"
 )
@@ -25,85 +28,46 @@ var (
 	version   string
 )
 
-// 定义配置结构体
-type config struct {
-	port int
-	env  string
-	db   struct {
-		dsn          string
-		maxOpenConns int
-		maxIdleConns int
-		maxIdleTime  string
-	}
-	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
-	}
-	smtp struct {
-		host     string
-		port     int
-		username string
-		password string
-		sender   string
-	}
-	cors struct {
-		trustedOrigins []string
-	}
-}
-
 // 应用结构体，用于存储应用程序的依赖项，handler，helper，middleware，logger等
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  atomic.Pointer[config] // 当前生效的配置，收到 SIGHUP 信号时会被整体替换
+	logger  *jsonlog.Logger
+	models  data.Models
+	mailer  mailer.Mailer
+	limiter ratelimit.Store
+	db      *sql.DB
+	wg      sync.WaitGroup
+
+	// 搜索建议和统计数据的缓存，键为规范化之后的查询参数
+	suggestions *cache.TTL[string, envelope]
+	stats       *cache.TTL[string, envelope]
+
+	// 正在运行的后台任务数量，以及服务器是否正在关闭，供就绪检查使用
+	backgroundTasks atomic.Int64
+	shuttingDown    atomic.Bool
+	smtpCheck       cachedCheck
 }
 
 func main() {
-	// 声明一个config实例
-	var cfg config
-
-	// 在命令行中设置配置
-	flag.IntVar(&cfg.port, "port", 4000, "API server port")
-	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-
-	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "PostgreSQL DSN")
-
-	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
-	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
-	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
-
-	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum request per second")
-	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
-	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
-
-	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
-	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
-	flag.StringVar(&cfg.smtp.username, "smtp-username", "d94086b9b52487", "SMTP username")
-	flag.StringVar(&cfg.smtp.password, "smtp-password", "db56cefb32b838", "SMTP password")
-	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@github/Alphasxd>", "SMTP sender")
-
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
-		cfg.cors.trustedOrigins = strings.Fields(val)
-		return nil
-	})
-
-	// 定义一个命令行参数，用于显示版本号
-	displayVersion := flag.Bool("version", false, "Display version and exit")
+	// 初始化一个logger实例，日志级别在加载配置之后再调整
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
-	// 解析命令行参数
-	flag.Parse()
+	// 依次从默认值、配置文件、环境变量和命令行参数中加载配置
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		logger.PrintFatal(err, nil)
+	}
 
-	if *displayVersion {
+	if cfg.displayVersion {
 		fmt.Printf("Version:\t%s\n", version)
 		fmt.Printf("Build time:\t%s\n", buildTime)
 		os.Exit(0)
 	}
 
-	// 初始化一个logger实例
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+	logger.SetLevel(cfg.logLevel)
 
 	db, err := openDB(cfg)
 	if err != nil {
@@ -138,13 +102,71 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	// 根据配置选择限流状态的存储后端，多实例部署时应使用 postgres 以共享配额
+	var limiter ratelimit.Store
+	switch cfg.limiter.store {
+	case "memory":
+		limiter = ratelimit.NewMemoryStore()
+	case "postgres":
+		limiter = ratelimit.NewPostgresStore(db)
+	}
+
+	// 根据配置选择邮件的发送方式
+	var sender mailer.Sender
+	switch cfg.mail.transport {
+	case "smtp":
+		sender = mailer.NewSMTPSender(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password)
+	case "file":
+		sender = &mailer.FileSender{Dir: cfg.mail.dir}
+	case "log":
+		sender = &mailer.LogSender{Logger: logger}
+	case "memory":
+		sender = &mailer.MemorySender{}
+	}
+
+	models := data.NewModels(db)
+
+	// 发送之前检查禁止发送名单，配置了私钥时为邮件添加 DKIM 签名，配置了退订地址时为非事务性邮件添加退订链接
+	mailOptions := mailer.Options{
+		Suppressions: models.Suppression,
+	}
+
+	if cfg.mail.dkimKeyFile != "" {
+		domain := cfg.mail.dkimDomain
+		if domain == "" {
+			domain = senderDomain(cfg.smtp.sender)
+		}
+
+		mailOptions.DKIM, err = mailer.NewDKIMSigner(domain, cfg.mail.dkimSelector, cfg.mail.dkimKeyFile)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	if cfg.mail.unsubscribeURL != "" {
+		mailOptions.UnsubscribeURL = func(recipient string) string {
+			return unsubscribeURL(cfg.mail.unsubscribeURL, cfg.mail.unsubscribeSecret, recipient)
+		}
+	}
+
+	// 所有邮件模板在启动时解析一次，模板有错误时直接退出
+	mail, err := mailer.New(sender, cfg.smtp.sender, mailOptions)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	// 初始化一个application实例
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		logger:  logger,
+		models:  models,
+		mailer:  mail,
+		limiter: limiter,
+		db:      db,
+
+		suggestions: cache.New[string, envelope](cfg.search.suggestCacheSize),
+		stats:       cache.New[string, envelope](cfg.stats.cacheSize),
 	}
+	app.config.Store(cfg)
 
 	// 调用serve方法启动服务器
 	err = app.serve()
@@ -153,7 +175,7 @@ func main() {
 	}
 }
 
-func openDB(cfg config) (*sql.DB, error) {
+func openDB(cfg *config) (*sql.DB, error) {
 	// 使用 dsn 字符串创建一个数据库连接池
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
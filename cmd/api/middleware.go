@@ -4,17 +4,16 @@ import (
 	"errors"
 	"expvar"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/Alphasxd/greenlight/internal/data"
+	"github.com/Alphasxd/greenlight/internal/ratelimit"
 	"github.com/Alphasxd/greenlight/internal/validator"
 	"github.com/felixge/httpsnoop"
-	"github.com/tomasen/realip"
-	"golang.org/x/time/rate"
 )
 
 // recoverPanic 是一个中间件，用来恢复 panic，并向客户端发送 500 Internal Server Error 响应。
@@ -30,69 +29,149 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-// rateLimit 是一个中间件，用来实现基于令牌桶的请求速率限制。
-func (app *application) rateLimit(next http.Handler) http.Handler {
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
+// strictTransportSecurity 是一个中间件，在生产环境中通过 TLS 提供服务时添加 HSTS 头信息
+func (app *application) strictTransportSecurity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && app.config.Load().env == "production" {
+			w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP 是一个中间件，用来解析客户端的 IP 地址并保存到请求的上下文中。
+// 只有当直接连接的对端属于 trusted-proxies 时，才会信任 X-Forwarded-For 和 X-Real-IP 头信息。
+func (app *application) clientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = app.contextSetClientIP(r, app.resolveClientIP(r))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// resolveClientIP 返回请求的客户端 IP 地址
+func (app *application) resolveClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
 	}
 
-	// 声明一个互斥锁和一个map，用来存储IP地址和相应的速率限制器
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !app.isTrustedProxy(peer) {
+		return host
+	}
 
-	// 启动一个后台goroutine，定期清理map中过期的速率限制器
-	go func() {
-		for {
-			time.Sleep(time.Minute)
+	// 从右往左遍历 X-Forwarded-For，跳过受信任的代理，第一个不受信任的地址就是客户端的地址
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
 
-			mu.Lock()
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr
+		if !app.isTrustedProxy(addr) {
+			break
+		}
+	}
 
-			for ip, client := range clients {
-				// 如果速率限制器距离上一次使用超过了 3 分钟，则将其从 map 中删除
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
+	if len(hops) == 0 {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			client = addr
+		}
+	}
 
-			mu.Unlock()
+	return client.Unmap().String()
+}
+
+// isTrustedProxy 检查 IP 地址是否属于受信任的代理
+func (app *application) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range app.config.Load().trustedProxies {
+		if prefix.Contains(addr) {
+			return true
 		}
-	}()
+	}
+	return false
+}
 
+// floodGuard 是一个中间件，放在 authenticate 之前，按 IP 地址限制所有路由的总请求速率。
+// 它的配额（limiter-flood-*）远大于普通的限流策略，只用来阻止猜测令牌这样的大量请求和它们带来的数据库查询，
+// 不会影响处于同一个 NAT 之后的正常用户。
+func (app *application) floodGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg := app.config.Load(); cfg.limiter.enabled {
+			limit := ratelimit.Limit{Rate: cfg.limiter.floodRPS, Burst: cfg.limiter.floodBurst}
+
+			result, err := app.limiter.Allow(r.Context(), "flood:ip:"+app.contextGetClientIP(r), limit)
+			if err != nil {
+				// 限流存储不可用时放行请求，避免数据库抖动导致整个 API 不可用
+				app.logError(r, err)
+			} else if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				app.rateLimitExceededResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit 是一个中间件，用来实现基于令牌桶的请求速率限制，不同的路由组（限流策略）使用各自独立的配额。
+// 它放在 authenticate 之后，每个请求只计入一个配额：已登录的用户按用户 ID 计算，匿名请求按 IP 地址计算，
+// 这样处于同一个 NAT 之后的用户不会相互影响。
+func (app *application) rateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 只有当速率限制器是启用的时候，才会执行速率限制
-		if app.config.limiter.enabled {
-			// 使用 realip.FromRequest() 函数获取客户端的 IP 地址
-			ip := realip.FromRequest(r)
+		if cfg := app.config.Load(); cfg.limiter.enabled {
+			name, limit := cfg.limiterPolicyFor(r)
 
-			mu.Lock()
+			key := "ip:" + app.contextGetClientIP(r)
+			if user := app.contextGetUser(r); !user.IsAnonymous() {
+				key = "user:" + strconv.FormatInt(user.ID, 10)
+			}
 
-			// 为 IP 地址对应的客户端创建一个新的速率限制器，存储到 clients map 中
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
-				}
+			result, err := app.limiter.Allow(r.Context(), name+":"+key, limit)
+			if err != nil {
+				// 限流存储不可用时放行请求，避免数据库抖动导致整个 API 不可用
+				app.logError(r, err)
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			// 更新客户端的最后活跃时间
-			clients[ip].lastSeen = time.Now()
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
 
 			// 检查与当前请求关联的速率限制器是否允许这个请求，如果不允许，则返回一个带有 429 状态码的响应
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
-
-			mu.Unlock()
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// limiterPolicyFor 返回请求匹配的第一个限流策略的名称和配额，没有匹配的策略时使用默认配额
+func (cfg *config) limiterPolicyFor(r *http.Request) (string, ratelimit.Limit) {
+	for _, policy := range cfg.limiter.policies {
+		for _, route := range policy.routes {
+			if routeMatches(route, r.Method, r.URL.Path) {
+				return policy.name, policy.limit
+			}
+		}
+	}
+
+	return "default", ratelimit.Limit{Rate: cfg.limiter.rps, Burst: cfg.limiter.burst}
+}
+
 // authenticate 是一个中间件，用来验证用户是否已经登录。
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -100,8 +179,27 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		authorizationHeader := r.Header.Get("Authorization")
 
+		// 没有 Bearer 令牌时，尝试使用已验证的客户端证书（mTLS）识别用户
 		if authorizationHeader == "" {
-			r = app.contextSetUser(r, data.AnonymousUser)
+			identities := clientCertificateIdentities(r)
+			if len(identities) == 0 {
+				r = app.contextSetUser(r, data.AnonymousUser)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := app.userForClientCertificate(identities)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidClientCertificateResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			r = app.contextSetUser(r, user)
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -137,6 +235,22 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// userForClientCertificate 依次使用证书中的标识查找用户（包括服务账号），返回第一个匹配的用户
+func (app *application) userForClientCertificate(identities []string) (*data.User, error) {
+	for _, identity := range identities {
+		user, err := app.models.Users.GetByEmail(identity)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		return user, nil
+	}
+
+	return nil, data.ErrRecordNotFound
+}
+
 // requireAuthenticatedUser 是一个中间件，用来验证用户是否已经登录。
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -199,29 +313,74 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 		w.Header().Add("Vary", "Origin")
 		w.Header().Add("Vary", "Access-Control-Request-Method")
 
+		// 每个请求只读取一次配置，避免在处理过程中遇到配置重新加载
+		cfg := app.config.Load()
+
 		origin := r.Header.Get("Origin")
-		if origin != "" && len(app.config.cors.trustedOrigins) != 0 {
-			for i := range app.config.cors.trustedOrigins {
-				// 如果请求的 Origin 头信息是可信任的，则将 Access-Control-Allow-Origin 头信息设置为匹配的 Origin 值
-				if origin == app.config.cors.trustedOrigins[i] {
+		if origin != "" {
+			// 预检请求需要按照实际请求将要使用的方法来匹配路由
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			method := r.Method
+			if preflight {
+				method = r.Header.Get("Access-Control-Request-Method")
+			}
+
+			for _, pattern := range cfg.corsOriginsFor(method, r.URL.Path) {
+				if !originMatches(pattern, origin) {
+					continue
+				}
+
+				// 开启凭证时 "*" 不能匹配任何来源，否则任何网站都可以携带用户的凭证读取响应。
+				// validateConfig 已经拒绝了这种配置，这里再检查一次作为防御
+				if pattern == "*" {
+					if cfg.cors.allowCredentials {
+						break
+					}
+					w.Header().Set("Access-Control-Allow-Origin", "*")
+				} else {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
 
-					// 检查请求是否是预检请求
-					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
-						// 如果是预检请求，则设置允许使用的 HTTP 方法的头信息
-						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				if cfg.cors.allowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
 
-						w.WriteHeader(http.StatusOK)
-						return
+				// 检查请求是否是预检请求
+				if preflight {
+					// 如果是预检请求，则设置允许使用的 HTTP 方法、头信息以及预检结果的缓存时间
+					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PUT, PATCH, DELETE")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+					if cfg.cors.maxAge > 0 {
+						w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.cors.maxAge.Seconds())))
 					}
+
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+
+				if len(cfg.cors.exposedHeaders) != 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(cfg.cors.exposedHeaders, ", "))
 				}
+				break
 			}
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// corsOriginsFor 返回请求匹配的第一个路由 CORS 策略允许的来源，没有匹配的策略时使用 cors-trusted-origins
+func (cfg *config) corsOriginsFor(method, path string) []string {
+	for _, policy := range cfg.cors.routePolicies {
+		for _, route := range policy.routes {
+			if routeMatches(route, method, path) {
+				return policy.origins
+			}
+		}
+	}
+
+	return cfg.cors.trustedOrigins
+}
+
 func (app *application) metrics(next http.Handler) http.Handler {
 	totalRequestReceived := expvar.NewInt("total_requests_received")
 	totalResponsesSent := expvar.NewInt("total_responses_sent")
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Alphasxd/greenlight/internal/data"
 	"github.com/Alphasxd/greenlight/internal/validator"
@@ -11,8 +15,8 @@ import (
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieFilters
+		Facets []string
 		data.Filters
 	}
 
@@ -20,25 +24,134 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	input.Facets = app.readCSV(qs, "facets", []string{})
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "rating", "relevance", "-id", "-title", "-year", "-runtime", "-rating"}
+
+	// 按标题搜索时默认按相关度排序，relevance 本身就是从高到低排序，所以没有 -relevance
+	if input.Title != "" {
+		input.Filters.Sort = app.readString(qs, "sort", "relevance")
+	} else {
+		input.Filters.Sort = app.readString(qs, "sort", "id")
+		v.Check(!strings.Contains(input.Filters.Sort, "relevance"), "sort", "relevance can only be used together with title")
+	}
+
+	for _, facet := range input.Facets {
+		v.Check(validator.In(facet, data.MovieFacets...), "facets", "must only contain genres, decade or runtime")
+	}
+	v.Check(validator.Unique(input.Facets), "facets", "must not contain duplicate values")
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieFilters, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	env := envelope{"movies": movies, "metadata": metadata}
+
+	// facets 参数是可选的，统计需要扫描所有符合条件的电影，所以只在请求时计算
+	if len(input.Facets) > 0 {
+		facets, err := app.models.Movies.Facets(input.MovieFilters, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+
+	// 搜索没有结果时，返回相似的标题作为提示
+	if len(movies) == 0 && input.Title != "" {
+		titles, err := app.models.Movies.DidYouMean(data.SearchText(input.Title))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(titles) > 0 {
+			env["did_you_mean"] = titles
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieFilters 从 URL 查询字符串参数中读取电影列表和统计共用的筛选条件并进行校验
+func (app *application) readMovieFilters(qs url.Values, v *validator.Validator) data.MovieFilters {
+	var f data.MovieFilters
+
+	f.Title = app.readString(qs, "title", "")
+	f.Language = app.readString(qs, "lang", "simple")
+	f.Genres = app.readCSV(qs, "genres", []string{})
+	f.GenresAny = app.readCSV(qs, "genres_any", []string{})
+	f.GenresNot = app.readCSV(qs, "genres_not", []string{})
+	f.YearMin = app.readInt32(qs, "year_min", 0, v)
+	f.YearMax = app.readInt32(qs, "year_max", 0, v)
+	f.RuntimeMin = data.Runtime(app.readInt32(qs, "runtime_min", 0, v))
+	f.RuntimeMax = data.Runtime(app.readInt32(qs, "runtime_max", 0, v))
+	f.CreatedAfter = app.readTime(qs, "created_after", time.Time{}, v)
+	f.PersonID = int64(app.readInt(qs, "person", 0, v))
+	f.Role = app.readString(qs, "role", "")
+
+	data.ValidateMovieFilters(v, f)
+
+	return f
+}
+
+// suggestMoviesHandler 处理 GET /v1/movie-suggestions，返回用户输入时的自动补全建议，包括标题匹配的电影和名称匹配的类型。
+// 相同的查询在短时间内会重复出现，所以结果会在进程内缓存一段时间。
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Q     string
+		Limit int
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	// 忽略大小写和多余的空格，这样它们可以共享同一个缓存
+	input.Q = strings.Join(strings.Fields(strings.ToLower(app.readString(qs, "q", ""))), " ")
+	input.Limit = app.readInt(qs, "limit", 5, v)
+
+	v.Check(utf8.RuneCountInString(input.Q) >= 2, "q", "must be at least 2 characters long")
+	v.Check(len(input.Q) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(input.Limit >= 1 && input.Limit <= 20, "limit", "must be between 1 and 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key := fmt.Sprintf("%d:%s", input.Limit, input.Q)
+
+	suggestions, ok := app.suggestions.Get(key)
+	if !ok {
+		movies, err := app.models.Movies.SuggestMovies(input.Q, input.Limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		genres, err := app.models.Movies.SuggestGenres(input.Q, input.Limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		suggestions = envelope{"movies": movies, "genres": genres}
+		app.suggestions.Set(key, suggestions, app.config.Load().search.suggestCacheTTL)
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -101,6 +214,19 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// 查询字符串包含 include=credits 时同时返回电影的演职员表
+	v := validator.New()
+
+	include := app.readCSV(r.URL.Query(), "include", []string{})
+	for _, value := range include {
+		v.Check(validator.In(value, "credits"), "include", "must only contain credits")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	// 调用 Get() 方法来获取指定 ID 的电影
 	movie, err := app.models.Movies.Get(id)
 	if err != nil {
@@ -114,6 +240,14 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if validator.In("credits", include...) {
+		movie.Credits, err = app.models.Credits.GetAllForMovie(movie.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	// 将 movie struct 实例封装为 JSON 格式并写入到响应体中
 	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
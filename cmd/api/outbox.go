@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/data"
+	"github.com/Alphasxd/greenlight/internal/mailer"
+)
+
+// outboxLockTimeout 之后仍处于 sending 状态的邮件会被重新投递，远大于 SMTP 的 5 秒超时
+const outboxLockTimeout = time.Minute
+
+// enqueueEmail 使用 models 将一封邮件写入发件箱，models 可以是 Transact 中的事务模型，这样邮件与业务数据一起提交或回滚
+func (app *application) enqueueEmail(models data.Models, user *data.User, templateFile string, templateData any) error {
+	_, err := models.Emails.Enqueue(user.ID, user.Email, templateFile, user.Locale, templateData, app.config.Load().mail.maxAttempts)
+	return err
+}
+
+// startOutbox 启动一个 goroutine 投递发件箱中的邮件，ctx 被取消后不再取出新的邮件
+func (app *application) startOutbox(ctx context.Context) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			email, err := app.models.Emails.Claim(outboxLockTimeout)
+			if err == nil {
+				app.deliverEmail(email)
+				continue
+			}
+
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.PrintError(err, nil)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(app.config.Load().mail.pollInterval):
+			}
+		}
+	}()
+}
+
+// deliverEmail 发送一封邮件，并记录投递结果，失败时按照与任务队列相同的退避策略重试
+func (app *application) deliverEmail(email *data.Email) {
+	app.backgroundTasks.Add(1)
+	defer app.backgroundTasks.Add(-1)
+
+	properties := map[string]string{
+		"email_id": strconv.FormatInt(email.ID, 10),
+		"template": email.Template,
+		"attempt":  strconv.Itoa(email.Attempts),
+	}
+
+	var templateData map[string]any
+	sendErr := json.Unmarshal(email.Data, &templateData)
+
+	var messageID string
+	if sendErr == nil {
+		messageID, sendErr = app.mailer.Send(email.Recipient, email.Template, email.Locale, templateData)
+	}
+
+	switch {
+	case sendErr == nil:
+		err := app.models.Emails.MarkSent(email, messageID)
+		if err != nil {
+			app.logger.PrintError(err, properties)
+		}
+		return
+	case errors.Is(sendErr, mailer.ErrSuppressed):
+		err := app.models.Emails.MarkSuppressed(email)
+		if err != nil {
+			app.logger.PrintError(err, properties)
+		}
+		return
+	}
+
+	err := app.models.Emails.Fail(email, sendErr, time.Now().Add(jobBackoff(email.Attempts)))
+	if err != nil {
+		app.logger.PrintError(err, properties)
+		return
+	}
+
+	properties["status"] = email.Status
+	app.logger.PrintError(sendErr, properties)
+}
@@ -24,13 +24,81 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	// httprouter 不允许 /v1/movies/suggest 和 /v1/movies/:id 同时注册，所以自动补全和导出使用单独的路径
+	router.HandlerFunc(http.MethodGet, "/v1/movie-suggestions", app.requirePermission("movies:read", app.suggestMoviesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movie-exports", app.requirePermission("movies:read", app.exportMoviesHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/imports", app.requirePermission("movies:write", app.importMoviesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/imports/:id", app.requirePermission("movies:write", app.showImportHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/imports/:id/errors", app.requirePermission("movies:write", app.listImportErrorsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/stats/movies", app.requirePermission("movies:read", app.movieStatsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.requirePermission("movies:read", app.listCreditsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requirePermission("movies:write", app.createCreditHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.requirePermission("movies:write", app.deleteCreditHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission("movies:read", app.listPeopleHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission("movies:write", app.createPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission("movies:read", app.showPersonHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission("movies:write", app.updatePersonHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission("movies:write", app.deletePersonHandler))
+
+	// 任何可以浏览电影的用户都可以发表评价，修改和删除评价的权限在处理函数中检查
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission("movies:read", app.listReviewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requirePermission("movies:read", app.createReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews/:review_id", app.requirePermission("movies:read", app.showReviewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", app.requirePermission("movies:read", app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.requirePermission("movies:read", app.deleteReviewHandler))
+
+	// 列表和观看记录属于当前用户，注册时获得的 movies:read 权限就足够管理自己的列表
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requirePermission("movies:read", app.listListsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:id/lists", app.requirePermission("movies:read", app.listUserListsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requirePermission("movies:read", app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.requirePermission("movies:read", app.showListHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requirePermission("movies:read", app.updateListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requirePermission("movies:read", app.deleteListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id/items", app.requirePermission("movies:read", app.listListItemsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/lists/:id/items/:movie_id", app.requirePermission("movies:read", app.putListItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/items/:movie_id", app.requirePermission("movies:read", app.deleteListItemHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/watched", app.requirePermission("movies:read", app.listWatchedHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/watched", app.requirePermission("movies:read", app.createWatchedHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/watched/:id", app.requirePermission("movies:read", app.deleteWatchedHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/:id/emails", app.requirePermission("emails:read", app.listUserEmailsHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
+	router.HandlerFunc(http.MethodPost, "/v1/emails/unsubscribe", app.unsubscribeHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/emails/suppressions", app.requirePermission("emails:read", app.listSuppressionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/emails/suppressions", app.requirePermission("emails:write", app.createSuppressionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/emails/suppressions/:email", app.requirePermission("emails:write", app.deleteSuppressionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/jobs", app.requirePermission("jobs:read", app.listJobsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/jobs/:id", app.requirePermission("jobs:read", app.showJobHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/jobs/:id/retry", app.requirePermission("jobs:write", app.retryJobHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/scheduled-tasks", app.requirePermission("jobs:read", app.listScheduledTasksHandler))
+
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	// 邮件模板预览供文案人员在本地查看效果，只在开发环境中注册
+	if app.config.Load().env == "development" {
+		router.HandlerFunc(http.MethodGet, "/v1/dev/emails", app.listEmailTemplatesHandler)
+		router.HandlerFunc(http.MethodGet, "/v1/dev/emails/:template", app.previewEmailHandler)
+	}
+
+	// floodGuard 按 IP 地址限制认证之前的请求；rateLimit 需要根据已登录的用户计算配额，所以放在 authenticate 之后
+	api := app.enableCORS(app.floodGuard(app.authenticate(app.rateLimit(router))))
+
+	// 存活和就绪探针不经过认证和限流，这样编排系统的探测请求不会收到 429；其它请求交给 api 处理
+	probes := httprouter.New()
+	probes.NotFound = api
+	probes.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+	probes.HandlerFunc(http.MethodGet, "/v1/healthz/live", app.livenessHandler)
+	probes.HandlerFunc(http.MethodGet, "/v1/healthz/ready", app.readinessHandler)
+
+	return app.metrics(app.clientIP(app.recoverPanic(app.strictTransportSecurity(probes))))
 }
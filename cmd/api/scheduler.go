@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/cron"
+	"github.com/Alphasxd/greenlight/internal/data"
+)
+
+// scheduledTask 是一个按照 cron 表达式定期执行的维护任务，run 返回受影响的行数
+type scheduledTask struct {
+	name     string
+	schedule cron.Schedule
+	run      func() (int64, error)
+}
+
+// scheduledTasks 返回启用的维护任务
+func (app *application) scheduledTasks() []scheduledTask {
+	cfg := app.config.Load()
+
+	// 配置在启动时已经校验过，这里不会解析失败
+	tokens, _ := cron.Parse(cfg.maintenance.tokensSchedule)
+	users, _ := cron.Parse(cfg.maintenance.usersSchedule)
+	imports, _ := cron.Parse(cfg.maintenance.importsSchedule)
+
+	tasks := []scheduledTask{
+		{
+			name:     "purge_expired_tokens",
+			schedule: tokens,
+			run:      app.models.Tokens.DeleteExpired,
+		},
+	}
+
+	// unactivated-user-days 为 0 时保留所有未激活的用户
+	if days := cfg.maintenance.unactivatedUserDays; days > 0 {
+		tasks = append(tasks, scheduledTask{
+			name:     "purge_unactivated_users",
+			schedule: users,
+			run: func() (int64, error) {
+				return app.models.Users.DeleteUnactivated(time.Duration(days) * 24 * time.Hour)
+			},
+		})
+	}
+
+	// import-rows-days 为 0 时保留导入中校验失败的行
+	if days := cfg.maintenance.importRowsDays; days > 0 {
+		tasks = append(tasks, scheduledTask{
+			name:     "purge_import_rows",
+			schedule: imports,
+			run: func() (int64, error) {
+				return app.models.Imports.PurgeRows(time.Duration(days) * 24 * time.Hour)
+			},
+		})
+	}
+
+	return tasks
+}
+
+// startScheduler 为每个维护任务启动一个 goroutine，在 ctx 被取消之前按计划执行任务
+func (app *application) startScheduler(ctx context.Context) {
+	if !app.config.Load().maintenance.enabled {
+		return
+	}
+
+	for _, task := range app.scheduledTasks() {
+		task := task
+
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+
+			for {
+				next := task.schedule.Next(time.Now())
+				if next.IsZero() {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Until(next)):
+				}
+
+				app.runScheduledTask(task, next)
+			}
+		}()
+	}
+}
+
+// runScheduledTask 在持有 advisory lock 的情况下执行一次维护任务，并记录执行结果。
+// 同一个计划时间点只会有一个实例执行任务，其它实例会直接跳过。
+func (app *application) runScheduledTask(task scheduledTask, slot time.Time) {
+	properties := map[string]string{
+		"task": task.name,
+	}
+
+	release, acquired, err := app.models.Scheduled.TryLock(task.name)
+	if err != nil {
+		app.logger.PrintError(err, properties)
+		return
+	}
+	if !acquired {
+		return
+	}
+	defer release()
+
+	// 其它实例可能已经执行过这个时间点的任务
+	last, err := app.models.Scheduled.Get(task.name)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.logger.PrintError(err, properties)
+		return
+	}
+	if last != nil && !last.LastRunAt.Before(slot) {
+		return
+	}
+
+	app.backgroundTasks.Add(1)
+	defer app.backgroundTasks.Add(-1)
+
+	start := time.Now()
+	affected, err := task.run()
+
+	record := &data.ScheduledTask{
+		Name:             task.name,
+		LastRunAt:        start,
+		LastStatus:       data.ScheduledTaskSucceeded,
+		LastDuration:     time.Since(start),
+		LastAffectedRows: affected,
+	}
+
+	if err != nil {
+		record.LastStatus = data.ScheduledTaskFailed
+		record.LastError = err.Error()
+		app.logger.PrintError(err, properties)
+	} else {
+		app.logger.PrintInfo("completed scheduled task", map[string]string{
+			"task":          task.name,
+			"affected_rows": strconv.FormatInt(affected, 10),
+			"duration":      record.LastDuration.String(),
+		})
+	}
+
+	err = app.models.Scheduled.RecordRun(record)
+	if err != nil {
+		app.logger.PrintError(err, properties)
+	}
+}
+
+// listScheduledTasksHandler 返回每个维护任务最近一次的执行情况。其中可能包含数据库的错误信息，
+// 所以不在公开的就绪探针中展示，而是需要 jobs:read 权限。
+func (app *application) listScheduledTasksHandler(w http.ResponseWriter, r *http.Request) {
+	tasks, err := app.models.Scheduled.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"scheduled_tasks": tasks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
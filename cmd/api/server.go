@@ -7,19 +7,88 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 )
 
 func (app *application) serve() error {
+	cfg := app.config.Load()
+
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.config.port),
+		Addr:         fmt.Sprintf(":%d", cfg.port),
 		Handler:      app.routes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// 指定了证书和私钥时，直接通过 TLS 提供服务，并监听证书文件的变化
+	var certs *certReloader
+	if cfg.tls.certFile != "" {
+		var err error
+		certs, err = newCertReloader(cfg.tls.certFile, cfg.tls.keyFile)
+		if err != nil {
+			return err
+		}
+
+		srv.TLSConfig, err = tlsConfig(cfg, certs)
+		if err != nil {
+			return err
+		}
+
+		go app.watchCertificate(certs)
+	}
+
+	// 可选的 HTTP 监听器，将所有请求重定向到 HTTPS
+	var redirectSrv *http.Server
+	if cfg.tls.redirectPort != 0 {
+		redirectSrv = app.redirectServer()
+
+		go func() {
+			err := redirectSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.logger.PrintError(err, map[string]string{
+					"addr": redirectSrv.Addr,
+				})
+			}
+		}()
+	}
+
+	// 启动任务队列的 worker、发件箱的投递进程和维护任务的调度器，关闭服务器时先停止取出新的任务，再等待正在执行的任务完成
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	app.startWorkers(workersCtx)
+	app.startOutbox(workersCtx)
+	app.startScheduler(workersCtx)
+
+	// 启动一个goroutine来监听 SIGHUP 信号，重新加载可以在运行时修改的配置
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+
+		for range hup {
+			if certs != nil {
+				err := certs.reload()
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{
+						"signal": syscall.SIGHUP.String(),
+					})
+				}
+			}
+
+			err := app.reloadConfig()
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{
+					"signal": syscall.SIGHUP.String(),
+				})
+				continue
+			}
+
+			app.logger.PrintInfo("reloaded configuration", nil)
+		}
+	}()
+
 	// shutdownError 通道用来接收服务器关闭时返回的错误
 	shutdownError := make(chan error)
 
@@ -38,30 +107,77 @@ func (app *application) serve() error {
 			"signal": s.String(),
 		})
 
-		// 创建一个5秒超时的上下文
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		// 关闭过程中再次收到信号时，不再等待，立即退出
+		go func() {
+			s := <-quit
+			app.logger.PrintInfo("caught second signal, forcing exit", map[string]string{
+				"signal": s.String(),
+			})
+			os.Exit(1)
+		}()
+
+		// 立即让就绪检查失败，这样负载均衡器会停止向这个实例发送新的请求
+		app.shuttingDown.Store(true)
+
+		// 在关闭监听器之前等待一段时间，给负载均衡器留出发现实例未就绪的时间
+		if cfg.shutdown.delay > 0 {
+			app.logger.PrintInfo("waiting before shutdown", map[string]string{
+				"delay": cfg.shutdown.delay.String(),
+			})
+			time.Sleep(cfg.shutdown.delay)
+		}
+
+		// 创建一个上下文，限制等待现有连接处理完成的时间
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdown.timeout)
 		defer cancel()
 
-		err := srv.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
+		if redirectSrv != nil {
+			_ = redirectSrv.Shutdown(ctx)
 		}
 
+		// 即使没能在超时之前处理完所有连接，也继续等待后台任务，最后再返回错误
+		shutdownErr := srv.Shutdown(ctx)
+
+		stopWorkers()
+
 		app.logger.PrintInfo("completing background tasks", map[string]string{
-			"addr": srv.Addr,
+			"addr":  srv.Addr,
+			"tasks": strconv.FormatInt(app.backgroundTasks.Load(), 10),
 		})
-		// 等待后台任务完成
-		app.wg.Wait()
-		shutdownError <- nil
+
+		// 等待后台任务完成，超时之后放弃仍在运行的任务，它们会在锁超时之后被其它实例重新执行
+		done := make(chan struct{})
+		go func() {
+			app.wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(cfg.shutdown.backgroundTimeout):
+			app.logger.PrintError(errors.New("timed out waiting for background tasks"), map[string]string{
+				"abandoned_tasks": strconv.FormatInt(app.backgroundTasks.Load(), 10),
+			})
+		}
+
+		shutdownError <- shutdownErr
 	}()
 
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
-		"env":  app.config.env,
+		"env":  cfg.env,
+		"tls":  strconv.FormatBool(certs != nil),
 	})
 
+	// 证书由 TLSConfig.GetCertificate 提供，所以这里不需要传入证书文件
+	var err error
+	if certs != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
 	// 检查 err 是否为 http.ErrServerClosed，如果不是，则返回 err
-	err := srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
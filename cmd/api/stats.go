@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Alphasxd/greenlight/internal/data"
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// movieStatsHandler 返回电影的汇总数据，例如每年的电影数量、每个类型的电影数量和每个年代的平均时长。
+// 筛选条件与 listMoviesHandler 相同，group_by 指定最多两个分组维度，按添加时间分组时 interval 指定时间粒度。
+// 相同的查询参数在一段时间内返回缓存的结果。
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.MovieFilters
+		GroupBy  []string
+		Interval string
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.MovieFilters = app.readMovieFilters(qs, v)
+	input.GroupBy = app.readCSV(qs, "group_by", []string{})
+	input.Interval = app.readString(qs, "interval", "month")
+
+	if data.ValidateStatsQuery(v, input.GroupBy, input.Interval); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// 缓存的 key 由校验后的查询条件生成，而不是原始的查询字符串，这样无关的参数、显式传递的默认值
+	// 和不按添加时间分组时的 interval 都不会产生新的缓存条目，调用方也就无法借此挤掉其它缓存
+	if !validator.In("added", input.GroupBy...) {
+		input.Interval = ""
+	}
+
+	key, err := json.Marshal(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	stats, ok := app.stats.Get(string(key))
+	if !ok {
+		total, groups, err := app.models.Movies.Stats(input.MovieFilters, input.GroupBy, input.Interval)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		stats = envelope{"total": total, "groups": groups}
+		app.stats.Set(string(key), stats, app.config.Load().stats.cacheTTL)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certReloader 保存当前使用的 TLS 证书，并在证书文件变化时重新加载。
+// 新证书只会用于之后的 TLS 握手，已经建立的连接不受影响。
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader 加载证书和私钥，并返回一个 certReloader 实例
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	err := c.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// reload 重新从文件中加载证书和私钥，加载失败时继续使用原来的证书
+func (c *certReloader) reload() error {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cert = &cert
+	c.modTime = modTime
+
+	return nil
+}
+
+// changed 检查证书或私钥文件在上一次加载之后是否被修改过
+func (c *certReloader) changed() bool {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return modTime.After(c.modTime)
+}
+
+// latestModTime 返回证书和私钥文件中较晚的修改时间
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// getCertificate 实现 tls.Config 的 GetCertificate 回调
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// watchCertificate 定期检查证书文件，如果文件发生变化则重新加载证书
+func (app *application) watchCertificate(certs *certReloader) {
+	for {
+		time.Sleep(10 * time.Second)
+
+		if !certs.changed() {
+			continue
+		}
+
+		err := certs.reload()
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"cert_file": certs.certFile,
+			})
+			continue
+		}
+
+		app.logger.PrintInfo("reloaded tls certificate", map[string]string{
+			"cert_file": certs.certFile,
+		})
+	}
+}
+
+// tlsConfig 返回一个只允许 TLS 1.2 及以上版本和 AEAD 加密套件的 tls.Config，并启用 HTTP/2。
+// 如果配置了 tls-client-ca，还会使用其中的 CA 校验客户端证书。
+func tlsConfig(cfg *config, certs *certReloader) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		// 只影响 TLS 1.2，TLS 1.3 的加密套件不可配置
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: certs.getCertificate,
+	}
+
+	if cfg.tls.clientCA != "" {
+		pem, err := os.ReadFile(cfg.tls.clientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.tls.clientCA)
+		}
+
+		tlsCfg.ClientCAs = pool
+		// optional 模式下没有证书的客户端仍然可以使用 Bearer 令牌，但提供的证书必须是有效的
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.tls.clientAuth == "require" {
+			tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tlsCfg, nil
+}
+
+// clientCertificateIdentities 返回已验证的客户端证书中可以用来查找用户的标识：
+// 先是 SAN 中的电子邮件地址，然后是 Subject 的 CN
+func clientCertificateIdentities(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+
+	identities := append([]string{}, cert.EmailAddresses...)
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+
+	return identities
+}
+
+// redirectServer 返回一个将所有 HTTP 请求重定向到 HTTPS 的服务器。
+// 服务器通常在负载均衡器之后监听其它端口，所以重定向使用 tls-public-host 和 tls-public-port，而不是 port。
+func (app *application) redirectServer() *http.Server {
+	cfg := app.config.Load()
+
+	return &http.Server{
+		Addr: fmt.Sprintf(":%d", cfg.tls.redirectPort),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := cfg.tls.publicHost
+			if host == "" {
+				var err error
+				host, _, err = net.SplitHostPort(r.Host)
+				if err != nil {
+					host = r.Host
+				}
+			}
+
+			// JoinHostPort 会为 IPv6 地址加上方括号，默认的 443 端口不需要写在 URL 中
+			host = net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(cfg.tls.publicPort))
+
+			target := url.URL{
+				Scheme:   "https",
+				Host:     strings.TrimSuffix(host, ":443"),
+				Path:     r.URL.Path,
+				RawQuery: r.URL.RawQuery,
+			}
+
+			http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+		}),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+	}
+}
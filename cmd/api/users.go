@@ -14,6 +14,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Locale   string `json:"locale"`
 	}
 
 	// 将 JSON 解码到 input 结构体中
@@ -28,6 +29,11 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Name:      input.Name,
 		Email:     input.Email,
 		Activated: false, // 默认情况下，新用户的激活状态为 false，显式指定有助于代码的可读性
+		Locale:    input.Locale,
+	}
+	// 没有指定语言时，使用英文发送邮件
+	if user.Locale == "" {
+		user.Locale = "en"
 	}
 	// 使用 Set() 方法设置密码
 	err = user.Password.Set(input.Password)
@@ -43,8 +49,37 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// 将用户信息插入到数据库中
-	err = app.models.Users.Insert(user)
+	// 用户、默认权限、默认列表、激活令牌和欢迎邮件在同一个事务中写入，邮件由发件箱异步投递，失败时会自动重试
+	err = app.models.Transact(func(tx data.Models) error {
+		err := tx.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+
+		// 为新用户添加默认权限
+		err = tx.Permissions.AddForUser(user.ID, "movies:read")
+		if err != nil {
+			return err
+		}
+
+		// 每个用户都有一个默认的待看列表，这样读取列表时不需要再写入数据库
+		err = tx.Lists.InsertDefault(user.ID)
+		if err != nil {
+			return err
+		}
+
+		token, err := tx.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		templateData := map[string]any{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+
+		return app.enqueueEmail(tx, user, "user_welcome.tmpl", templateData)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -56,32 +91,6 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// 为新用户添加默认权限
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// 调用 background() 方法，将发送欢迎邮件的任务放入任务队列中
-	app.background(func() {
-		routieData := map[string]any{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
-		}
-
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", routieData)
-		if err != nil {
-			app.logger.PrintError(err, nil)
-		}
-	})
-
 	// 将用户信息以 JSON 格式写入响应体中，并将状态码设为 201 Created
 	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
 	if err != nil {
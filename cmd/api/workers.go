@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/data"
+)
+
+// jobHandler 执行一种类型的任务，返回错误时任务会按照退避策略重试
+type jobHandler func(ctx context.Context, job *data.Job) error
+
+// jobHandlers 返回任务类型和对应的处理函数
+func (app *application) jobHandlers() map[string]jobHandler {
+	return map[string]jobHandler{
+		data.JobWelcomeEmail: app.welcomeEmailJob,
+		data.JobMovieImport:  app.movieImportJob,
+	}
+}
+
+// enqueueJob 使用配置的最大尝试次数将一个任务放入队列
+func (app *application) enqueueJob(kind string, payload any) error {
+	_, err := app.models.Jobs.Enqueue(kind, payload, app.config.Load().jobs.maxAttempts)
+	return err
+}
+
+// startWorkers 启动 jobs-workers 个 worker 从任务队列中取出任务并执行，ctx 被取消后 worker 不再取出新的任务
+func (app *application) startWorkers(ctx context.Context) {
+	handlers := app.jobHandlers()
+
+	for i := 0; i < app.config.Load().jobs.workers; i++ {
+		// 增加 WaitGroup 的计数器，关闭服务器时会等待正在执行的任务完成
+		app.wg.Add(1)
+
+		go func() {
+			defer app.wg.Done()
+			app.runWorker(ctx, handlers)
+		}()
+	}
+}
+
+// runWorker 循环地取出并执行任务，队列为空时等待 jobs-poll-interval 之后再次检查
+func (app *application) runWorker(ctx context.Context, handlers map[string]jobHandler) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		cfg := app.config.Load()
+
+		// 执行超过两倍超时时间的任务被视为已经失去了 worker，允许其它 worker 重新取出
+		job, err := app.models.Jobs.Claim(2 * cfg.jobs.timeout)
+		if err == nil {
+			app.runJob(job, handlers)
+			continue
+		}
+
+		if !errors.Is(err, data.ErrRecordNotFound) {
+			app.logger.PrintError(err, nil)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cfg.jobs.pollInterval):
+		}
+	}
+}
+
+// runJob 执行一个任务，并根据执行结果更新任务的状态
+func (app *application) runJob(job *data.Job, handlers map[string]jobHandler) {
+	app.backgroundTasks.Add(1)
+	defer app.backgroundTasks.Add(-1)
+
+	properties := map[string]string{
+		"job_id":   strconv.FormatInt(job.ID, 10),
+		"job_kind": job.Kind,
+		"attempt":  strconv.Itoa(job.Attempts),
+	}
+
+	jobErr := app.executeJob(job, handlers)
+	if jobErr == nil {
+		err := app.models.Jobs.Complete(job.ID)
+		if err != nil {
+			app.logger.PrintError(err, properties)
+		}
+		return
+	}
+
+	err := app.models.Jobs.Fail(job, jobErr, time.Now().Add(jobBackoff(job.Attempts)))
+	if err != nil {
+		app.logger.PrintError(err, properties)
+		return
+	}
+
+	properties["status"] = job.Status
+	app.logger.PrintError(jobErr, properties)
+}
+
+// executeJob 调用任务对应的处理函数，并将处理函数中的 panic 转换为错误
+func (app *application) executeJob(job *data.Job, handlers map[string]jobHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %s", p)
+		}
+	}()
+
+	handler, ok := handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.config.Load().jobs.timeout)
+	defer cancel()
+
+	return handler(ctx, job)
+}
+
+// jobBackoff 返回第 attempts 次执行失败之后需要等待的时间：30 秒起，每次翻倍，最多 1 小时
+func jobBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, time.Hour)
+}
+
+// welcomeEmailJob 为新用户生成激活令牌，并将欢迎邮件写入发件箱。
+// 新注册的用户直接在注册的事务中写入发件箱，这个任务只用来处理发件箱上线之前已经入队的任务。
+func (app *application) welcomeEmailJob(ctx context.Context, job *data.Job) error {
+	var payload data.WelcomeEmailPayload
+
+	err := json.Unmarshal(job.Payload, &payload)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.models.Users.Get(payload.UserID)
+	if err != nil {
+		return err
+	}
+
+	// 用户在任务重试之前已经激活，不需要再发送邮件
+	if user.Activated {
+		return nil
+	}
+
+	return app.models.Transact(func(tx data.Models) error {
+		token, err := tx.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		templateData := map[string]any{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+
+		return app.enqueueEmail(tx, user, "user_welcome.tmpl", templateData)
+	})
+}
@@ -10,9 +10,8 @@ require (
 require (
 	github.com/felixge/httpsnoop v1.0.3
 	github.com/go-mail/mail v2.3.1+incompatible
-	github.com/tomasen/realip v0.0.0-20180522021738-f0c99a92ddce
 	golang.org/x/crypto v0.12.0
-	golang.org/x/time v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
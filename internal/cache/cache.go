@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// entry 是缓存中的一个值以及它的过期时间
+type entry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// TTL 是一个进程内的缓存，每个值在写入时指定有效期，过期之后视为不存在。
+// 缓存中的值超过 maxEntries 个时，写入新值之前会先删除过期的值，仍然超过时随机删除一个值。
+type TTL[K comparable, V any] struct {
+	mu         sync.Mutex
+	entries    map[K]entry[V]
+	maxEntries int
+}
+
+// New 创建一个最多保存 maxEntries 个值的缓存，并启动一个后台 goroutine 定期清理过期的值
+func New[K comparable, V any](maxEntries int) *TTL[K, V] {
+	c := &TTL[K, V]{
+		entries:    make(map[K]entry[V]),
+		maxEntries: maxEntries,
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			c.mu.Lock()
+			c.deleteExpired(time.Now())
+			c.mu.Unlock()
+		}
+	}()
+
+	return c
+}
+
+// Get 返回 key 对应的值，值不存在或者已经过期时 ok 为 false
+func (c *TTL[K, V]) Get(key K) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.entries[key]
+	if !found || !time.Now().Before(e.expiresAt) {
+		return value, false
+	}
+
+	return e.value, true
+}
+
+// Set 写入 key 对应的值，值在 ttl 之后过期，ttl 不大于 0 时不写入
+func (c *TTL[K, V]) Set(key K, value V, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if _, found := c.entries[key]; !found && len(c.entries) >= c.maxEntries {
+		c.deleteExpired(now)
+
+		// map 的遍历顺序是随机的，删除第一个遍历到的值相当于随机淘汰
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = entry[V]{value: value, expiresAt: now.Add(ttl)}
+}
+
+// Clear 删除缓存中的所有值，例如数据发生变化时
+func (c *TTL[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+}
+
+// deleteExpired 删除所有在 now 之前过期的值，调用时必须持有锁
+func (c *TTL[K, V]) deleteExpired(now time.Time) {
+	for key, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
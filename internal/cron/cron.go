@@ -0,0 +1,168 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 表示一个标准的 5 段 cron 表达式：分 时 日 月 周
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// 日和周都被限制时，只要满足其中一个即可（与 vixie cron 的行为一致）
+	domStar, dowStar bool
+}
+
+// field 描述 cron 表达式中一段的取值范围
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// macros 定义了常用的 cron 表达式别名
+var macros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// Parse 解析 cron 表达式，每一段支持 *、数字、范围 a-b、步长 */n 或 a-b/n，以及使用逗号分隔的列表
+func Parse(spec string) (Schedule, error) {
+	if expanded, ok := macros[strings.TrimSpace(spec)]; ok {
+		spec = expanded
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("cron: expected %d fields in %q", len(fields), spec)
+	}
+
+	var bits [5]uint64
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return Schedule{}, err
+		}
+		bits[i] = b
+	}
+
+	// 周日既可以写成 0 也可以写成 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return Schedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}, nil
+}
+
+// parseField 将 cron 表达式中的一段解析为位图
+func parseField(part string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, item := range strings.Split(part, ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("cron: invalid step %q in %s field", stepText, f.name)
+			}
+			step = n
+		}
+
+		low, high := f.min, f.max
+		if rng != "*" {
+			lowText, highText, isRange := strings.Cut(rng, "-")
+
+			var err error
+			low, err = strconv.Atoi(lowText)
+			if err != nil {
+				return 0, fmt.Errorf("cron: invalid value %q in %s field", rng, f.name)
+			}
+
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highText)
+				if err != nil {
+					return 0, fmt.Errorf("cron: invalid value %q in %s field", rng, f.name)
+				}
+			} else if hasStep {
+				// "5/15" 表示从 5 开始，每 15 个单位一次
+				high = f.max
+			}
+		}
+
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("cron: value %q out of range in %s field", item, f.name)
+		}
+
+		for i := low; i <= high; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// Next 返回严格晚于 t 的下一个满足表达式的时间点，精确到分钟。五年内没有满足的时间点时返回零值。
+func (s Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches 检查 t 是否满足日和周两段的限制
+func (s Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
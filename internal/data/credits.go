@@ -0,0 +1,181 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// 演职员的职位，演员属于 cast，其它职位属于 crew
+const (
+	RoleDirector = "director"
+	RoleActor    = "actor"
+	RoleWriter   = "writer"
+)
+
+// CreditRoles 是所有有效的职位
+var CreditRoles = []string{RoleDirector, RoleActor, RoleWriter}
+
+var (
+	// ErrDuplicateCredit 表示电影中已经存在相同人物、职位和角色的演职员记录。
+	ErrDuplicateCredit = errors.New("duplicate credit")
+)
+
+// Credit 记录一个人物在一部电影中的职位，Character 是演员饰演的角色，BillingOrder 越小在演职员表中越靠前
+type Credit struct {
+	ID           int64   `json:"id"`
+	MovieID      int64   `json:"movie_id"`
+	Person       *Person `json:"person"`
+	Role         string  `json:"role"`
+	Character    string  `json:"character,omitempty"`
+	BillingOrder int32   `json:"billing_order"`
+}
+
+// Credits 是一部电影的演职员表，分为演员（cast）和其他职员（crew）
+type Credits struct {
+	Cast []*Credit `json:"cast"`
+	Crew []*Credit `json:"crew"`
+}
+
+type CreditModel struct {
+	DB DBTX
+}
+
+// ValidateCredit 方法检查演职员记录是否有效，只有演员可以有饰演的角色。
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.Role != "", "role", "must be provided")
+	v.Check(validator.In(credit.Role, CreditRoles...), "role", "must be one of director, actor or writer")
+
+	if credit.Role == RoleActor {
+		v.Check(credit.Character != "", "character", "must be provided for actors")
+	} else {
+		v.Check(credit.Character == "", "character", "must only be provided for actors")
+	}
+	v.Check(len(credit.Character) <= 500, "character", "must not be more than 500 bytes long")
+
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
+
+// Insert 方法为电影添加一条演职员记录。
+// 相同的记录已经存在时返回 ErrDuplicateCredit，电影或者人物不存在时返回 ErrRecordNotFound。
+func (m CreditModel) Insert(credit *Credit) error {
+	query := `
+		INSERT INTO credits (movie_id, person_id, role, character, billing_order)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	args := []any{credit.MovieID, credit.Person.ID, credit.Role, credit.Character, credit.BillingOrder}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&credit.ID)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `unique constraint "credits_movie_id_person_id_role_character_key"`):
+			return ErrDuplicateCredit
+		case strings.Contains(err.Error(), `foreign key constraint "credits_movie_id_fkey"`),
+			strings.Contains(err.Error(), `foreign key constraint "credits_person_id_fkey"`):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAllForMovie 方法返回一部电影的演职员表，按照 billing_order 和姓名排序。
+func (m CreditModel) GetAllForMovie(movieID int64) (*Credits, error) {
+	query := `
+		SELECT credits.id, credits.movie_id, credits.role, credits.character, credits.billing_order,
+		       people.id, people.created_at, people.name, people.birth_date, people.biography, people.version
+		FROM credits
+		INNER JOIN people ON people.id = credits.person_id
+		WHERE credits.movie_id = $1
+		ORDER BY credits.billing_order ASC, people.name ASC, credits.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	// 没有演职员时返回空数组，而不是 null
+	credits := &Credits{Cast: []*Credit{}, Crew: []*Credit{}}
+
+	for rows.Next() {
+		credit := Credit{Person: &Person{}}
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+			&credit.Person.ID,
+			&credit.Person.CreatedAt,
+			&credit.Person.Name,
+			&credit.Person.BirthDate,
+			&credit.Person.Biography,
+			&credit.Person.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if credit.Role == RoleActor {
+			credits.Cast = append(credits.Cast, &credit)
+		} else {
+			credits.Crew = append(credits.Crew, &credit)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// Delete 方法删除电影中指定 ID 的演职员记录。
+func (m CreditModel) Delete(movieID, id int64) error {
+	if movieID < 1 || id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM credits
+		WHERE id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
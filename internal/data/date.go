@@ -0,0 +1,71 @@
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// dateLayout 是 Date 在 JSON 中的格式
+const dateLayout = "2006-01-02"
+
+// Date 是一个不包含时间的日期，在 JSON 中表示为 "2006-01-02" 格式的字符串，对应数据库中的 date 类型
+type Date time.Time
+
+// ErrInvalidDateFormat 定义一个错误，当 UnmarshalJSON 方法无法解码 JSON 数据时，会返回该错误
+var ErrInvalidDateFormat = errors.New("invalid date format, expected YYYY-MM-DD")
+
+// Today 返回当天的日期
+func Today() Date {
+	y, m, d := time.Now().Date()
+	return Date(time.Date(y, m, d, 0, 0, 0, 0, time.UTC))
+}
+
+// MarshalJSON 实现对自定义类型 Date 的 MarshalJSON 方法
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(time.Time(d).Format(dateLayout))), nil
+}
+
+// UnmarshalJSON 实现对自定义类型 Date 的 UnmarshalJSON 方法
+func (d *Date) UnmarshalJSON(jsonValue []byte) error {
+	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	t, err := time.Parse(dateLayout, unquotedJSONValue)
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	*d = Date(t)
+	return nil
+}
+
+// IsZero 检查日期是否为零值，即没有被设置
+func (d Date) IsZero() bool {
+	return time.Time(d).IsZero()
+}
+
+// After 检查 d 是否晚于 other
+func (d Date) After(other Date) bool {
+	return time.Time(d).After(time.Time(other))
+}
+
+// Scan 实现 sql.Scanner 接口，从数据库的 date 类型中读取日期
+func (d *Date) Scan(src any) error {
+	t, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+
+	*d = Date(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	return nil
+}
+
+// Value 实现 driver.Valuer 接口，将日期以 YYYY-MM-DD 格式写入数据库
+func (d Date) Value() (driver.Value, error) {
+	return time.Time(d).Format(dateLayout), nil
+}
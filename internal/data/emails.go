@@ -0,0 +1,250 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// 邮件的投递状态
+const (
+	EmailPending    = "pending"
+	EmailSending    = "sending"
+	EmailSent       = "sent"
+	EmailFailed     = "failed"     // 重试次数用尽，不会再投递
+	EmailSuppressed = "suppressed" // 收件人在禁止发送名单中，不会再投递
+)
+
+// Email 是发件箱中的一封邮件，与产生它的业务数据在同一个事务中写入，然后由投递进程异步发送
+type Email struct {
+	ID            int64           `json:"id"`
+	UserID        int64           `json:"user_id"`
+	Recipient     string          `json:"recipient"`
+	Template      string          `json:"template"`
+	Locale        string          `json:"locale"`
+	Data          json.RawMessage `json:"-"` // 可能包含激活令牌等敏感信息，不在 API 中返回
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	MaxAttempts   int             `json:"max_attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     string          `json:"last_error,omitempty"`
+	MessageID     string          `json:"message_id,omitempty"`
+	SentAt        *time.Time      `json:"sent_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+type EmailModel struct {
+	DB DBTX
+}
+
+// ValidateEmailStatus 检查投递状态过滤条件是否有效
+func ValidateEmailStatus(v *validator.Validator, status string) {
+	v.Check(status == "" || validator.In(status, EmailPending, EmailSending, EmailSent, EmailFailed, EmailSuppressed), "status", "invalid status value")
+}
+
+// Enqueue 方法将一封邮件写入发件箱，templateData 会被编码为 JSON。
+// 邮件使用收件人偏好的 locale 对应的模板渲染。
+func (m EmailModel) Enqueue(userID int64, recipient, template, locale string, templateData any, maxAttempts int) (*Email, error) {
+	js, err := json.Marshal(templateData)
+	if err != nil {
+		return nil, err
+	}
+
+	email := &Email{
+		UserID:      userID,
+		Recipient:   recipient,
+		Template:    template,
+		Locale:      locale,
+		Data:        js,
+		Status:      EmailPending,
+		MaxAttempts: maxAttempts,
+	}
+
+	query := `
+		INSERT INTO emails (user_id, recipient, template, locale, data, max_attempts)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, next_attempt_at, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{userID, recipient, template, locale, []byte(js), maxAttempts}
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&email.ID, &email.NextAttemptAt, &email.CreatedAt, &email.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return email, nil
+}
+
+// Claim 方法取出一封可以投递的邮件，并将其标记为 sending。
+// 处于 sending 状态超过 lockTimeout 的邮件被视为投递它的进程已经崩溃，会被重新取出。
+// 没有可以投递的邮件时返回 ErrRecordNotFound。
+func (m EmailModel) Claim(lockTimeout time.Duration) (*Email, error) {
+	query := `
+		UPDATE emails
+		SET status = 'sending', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM emails
+			WHERE (status = 'pending' AND next_attempt_at <= NOW())
+			OR (status = 'sending' AND locked_at < NOW() - make_interval(secs => $1))
+			ORDER BY next_attempt_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, user_id, recipient, template, locale, data, status, attempts, max_attempts,
+		          next_attempt_at, last_error, message_id, sent_at, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var email Email
+
+	err := m.DB.QueryRowContext(ctx, query, lockTimeout.Seconds()).Scan(
+		&email.ID,
+		&email.UserID,
+		&email.Recipient,
+		&email.Template,
+		&email.Locale,
+		&email.Data,
+		&email.Status,
+		&email.Attempts,
+		&email.MaxAttempts,
+		&email.NextAttemptAt,
+		&email.LastError,
+		&email.MessageID,
+		&email.SentAt,
+		&email.CreatedAt,
+		&email.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &email, nil
+}
+
+// MarkSent 方法记录邮件已经投递成功，以及邮件服务商使用的 Message-ID。
+// 模板数据在投递之后不再需要，同时清空以免激活令牌等信息留在数据表中。
+func (m EmailModel) MarkSent(email *Email, messageID string) error {
+	query := `
+		UPDATE emails
+		SET status = 'sent', data = '{}', locked_at = NULL, last_error = '', message_id = $1,
+		    sent_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, sent_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	email.MessageID = messageID
+	email.LastError = ""
+
+	return m.DB.QueryRowContext(ctx, query, messageID, email.ID).Scan(&email.Status, &email.SentAt, &email.UpdatedAt)
+}
+
+// MarkSuppressed 方法记录邮件因为收件人在禁止发送名单中而没有投递，这样的邮件不会重试。
+func (m EmailModel) MarkSuppressed(email *Email) error {
+	query := `
+		UPDATE emails
+		SET status = 'suppressed', data = '{}', locked_at = NULL, last_error = '', updated_at = NOW()
+		WHERE id = $1
+		RETURNING status, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, email.ID).Scan(&email.Status, &email.UpdatedAt)
+}
+
+// Fail 方法记录投递失败的原因。如果还有重试次数，邮件会在 retryAt 之后重新投递，否则进入 failed 状态。
+// 与 MarkSent 一样，进入 failed 状态的邮件不会再投递，所以同时清除其中可能包含令牌的模板数据。
+func (m EmailModel) Fail(email *Email, sendErr error, retryAt time.Time) error {
+	query := `
+		UPDATE emails
+		SET status = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'pending' END,
+		    data = CASE WHEN attempts >= max_attempts THEN '{}' ELSE data END,
+		    next_attempt_at = $1, locked_at = NULL, last_error = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING status, next_attempt_at, last_error, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, retryAt, sendErr.Error(), email.ID).Scan(&email.Status, &email.NextAttemptAt, &email.LastError, &email.UpdatedAt)
+}
+
+// GetAllForUser 方法返回发送给指定用户的邮件及其投递状态，status 为空时不进行过滤。
+func (m EmailModel) GetAllForUser(userID int64, status string, filters Filters) ([]*Email, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, user_id, recipient, template, locale, status, attempts, max_attempts,
+		       next_attempt_at, last_error, message_id, sent_at, created_at, updated_at
+		FROM emails
+		WHERE user_id = $1
+		AND (status = $2 OR $2 = '')
+		ORDER BY %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var totalRecords int
+	var emails []*Email
+
+	for rows.Next() {
+		var email Email
+		err := rows.Scan(
+			&totalRecords,
+			&email.ID,
+			&email.UserID,
+			&email.Recipient,
+			&email.Template,
+			&email.Locale,
+			&email.Status,
+			&email.Attempts,
+			&email.MaxAttempts,
+			&email.NextAttemptAt,
+			&email.LastError,
+			&email.MessageID,
+			&email.SentAt,
+			&email.CreatedAt,
+			&email.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		emails = append(emails, &email)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return emails, metadata, nil
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// stubConnector 是一个只返回固定结果的数据库驱动，用于在没有 PostgreSQL 的情况下检查查询结果的扫描
+type stubConnector struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (c *stubConnector) Connect(context.Context) (driver.Conn, error) { return &stubConn{c}, nil }
+func (c *stubConnector) Driver() driver.Driver                        { return nil }
+
+type stubConn struct{ c *stubConnector }
+
+func (c *stubConn) Prepare(string) (driver.Stmt, error) { return &stubStmt{c.c}, nil }
+func (c *stubConn) Close() error                        { return nil }
+func (c *stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type stubStmt struct{ c *stubConnector }
+
+func (s *stubStmt) Close() error  { return nil }
+func (s *stubStmt) NumInput() int { return -1 }
+func (s *stubStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *stubStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &stubRows{columns: s.c.columns, rows: s.c.rows}, nil
+}
+
+type stubRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+func (r *stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestEmailModelGetAllForUser(t *testing.T) {
+	now := time.Now()
+
+	db := sql.OpenDB(&stubConnector{
+		columns: []string{"count", "id", "user_id", "recipient", "template", "locale", "status", "attempts", "max_attempts",
+			"next_attempt_at", "last_error", "message_id", "sent_at", "created_at", "updated_at"},
+		rows: [][]driver.Value{
+			{int64(1), int64(7), int64(3), "alice@example.com", "user_welcome", "zh-CN", EmailSent, int64(1), int64(5),
+				now, "", "<id@example.com>", now, now, now},
+		},
+	})
+	defer db.Close()
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "-created_at", SortSafelist: []string{"-created_at"}}
+
+	emails, metadata, err := EmailModel{DB: db}.GetAllForUser(3, "", filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(emails) != 1 {
+		t.Fatalf("got %d emails; want 1", len(emails))
+	}
+
+	email := emails[0]
+	if email.ID != 7 || email.Locale != "zh-CN" || email.Status != EmailSent || email.MaxAttempts != 5 || email.SentAt == nil {
+		t.Errorf("got %+v", email)
+	}
+
+	if metadata.TotalRecords != 1 {
+		t.Errorf("got %d total records; want 1", metadata.TotalRecords)
+	}
+}
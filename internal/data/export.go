@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// exportFetchSize 是导出时每次从游标中读取的行数
+const exportFetchSize = 500
+
+// Export 方法通过数据库游标按 ID 顺序读取所有符合筛选条件的电影，每读取一部电影调用一次 fn。
+// 每次只从游标中读取 exportFetchSize 行，所以内存占用与电影的数量无关。
+// 游标只在事务中有效，所以必须在 Models.Transact 中通过 tx.Movies 调用。
+// ctx 被取消（例如客户端断开连接）或者 fn 返回错误时停止读取并返回这个错误。
+func (m MovieModel) Export(ctx context.Context, movieFilters MovieFilters, fn func(*Movie) error) error {
+	query := fmt.Sprintf(`
+        DECLARE movies_export NO SCROLL CURSOR FOR
+        SELECT id, created_at, title, year, runtime, genres, rating, rating_count, version
+        FROM movies
+        WHERE %s
+        ORDER BY id ASC`, movieFilters.where())
+
+	err := m.exec(ctx, query, movieFilters.args()...)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := m.fetchExport(ctx, fn)
+		if err != nil {
+			return err
+		}
+
+		if n < exportFetchSize {
+			break
+		}
+	}
+
+	return m.exec(ctx, `CLOSE movies_export`)
+}
+
+// fetchExport 方法从游标中读取下一批电影并逐个传递给 fn，返回读取的行数
+func (m MovieModel) fetchExport(ctx context.Context, fn func(*Movie) error) (int, error) {
+	query := fmt.Sprintf(`FETCH FORWARD %d FROM movies_export`, exportFetchSize)
+
+	// 每次读取仍然有 3 秒的超时时间，fn 写入响应的时间不计算在内
+	queryCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(queryCtx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	// 先读取这一批中的所有行再调用 fn，这样查询的超时时间不受客户端读取速度的影响
+	movies := make([]*Movie, 0, exportFetchSize)
+
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Rating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return 0, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, movie := range movies {
+		err := fn(movie)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(movies), nil
+}
+
+// exec 方法在 3 秒的超时时间内执行一条不返回行的语句
+func (m MovieModel) exec(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,131 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieFacets 是电影列表支持的分面统计
+var MovieFacets = []string{"genres", "decade", "runtime"}
+
+// FacetCount 是分面统计中的一项，Min 和 Max 是这一项对应的取值范围（包含），可以直接用作
+// year_min/year_max 或 runtime_min/runtime_max 筛选条件，为 0 时表示没有下限或者上限
+type FacetCount struct {
+	Value string `json:"value"`
+	Min   int32  `json:"min,omitempty"`
+	Max   int32  `json:"max,omitempty"`
+	Count int    `json:"count"`
+}
+
+// runtimeBuckets 是时长分面的区间，最后一个区间没有上限
+var runtimeBuckets = [][2]int32{{0, 89}, {90, 119}, {120, 149}, {150, 0}}
+
+// Facets 方法统计符合筛选条件的所有电影（不分页）在 facets 中每个分面上的数量。
+// 筛选条件与 GetAll 完全相同，所以统计结果与列表的结果一致。
+func (m MovieModel) Facets(movieFilters MovieFilters, facets []string) (map[string][]*FacetCount, error) {
+	buckets := make([]string, len(runtimeBuckets))
+	for i, bucket := range runtimeBuckets {
+		buckets[i] = fmt.Sprintf("(%d, %d)", bucket[0], bucket[1])
+	}
+
+	query := fmt.Sprintf(`
+        WITH filtered AS (
+            SELECT genres, year, runtime
+            FROM movies
+            WHERE %s
+        )
+        SELECT 'genres', genre, 0, 0, count(*)
+        FROM filtered, unnest(genres) AS genre
+        WHERE 'genres' = ANY($12)
+        GROUP BY genre
+        UNION ALL
+        SELECT 'decade', '', year / 10 * 10, year / 10 * 10 + 9, count(*)
+        FROM filtered
+        WHERE 'decade' = ANY($12)
+        GROUP BY year / 10 * 10
+        UNION ALL
+        SELECT 'runtime', '', buckets.min, buckets.max, count(*)
+        FROM filtered
+        INNER JOIN (VALUES %s) AS buckets (min, max)
+        ON runtime >= buckets.min AND (runtime <= buckets.max OR buckets.max = 0)
+        WHERE 'runtime' = ANY($12)
+        GROUP BY buckets.min, buckets.max`, movieFilters.where(), strings.Join(buckets, ", "))
+
+	args := append(movieFilters.args(), pq.Array(facets))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	// 请求的分面即使没有任何结果也返回空数组
+	result := make(map[string][]*FacetCount, len(facets))
+	for _, facet := range facets {
+		result[facet] = []*FacetCount{}
+	}
+
+	for rows.Next() {
+		var facet string
+		var count FacetCount
+		err := rows.Scan(&facet, &count.Value, &count.Min, &count.Max, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case "decade":
+			count.Value = fmt.Sprintf("%ds", count.Min)
+		case "runtime":
+			count.Value = runtimeBucketLabel(count.Min, count.Max)
+		}
+
+		result[facet] = append(result[facet], &count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 类型按数量从多到少排列，年代和时长按区间从小到大排列
+	for facet, counts := range result {
+		sort.Slice(counts, func(i, j int) bool {
+			if facet == "genres" {
+				if counts[i].Count != counts[j].Count {
+					return counts[i].Count > counts[j].Count
+				}
+				return counts[i].Value < counts[j].Value
+			}
+			return counts[i].Min < counts[j].Min
+		})
+	}
+
+	return result, nil
+}
+
+// runtimeBucketLabel 返回时长区间的名称，例如 "90-119 mins" 和 "150+ mins"
+func runtimeBucketLabel(min, max int32) string {
+	switch {
+	case max == 0:
+		return fmt.Sprintf("%d+ mins", min)
+	case min == 0:
+		return fmt.Sprintf("<%d mins", max+1)
+	default:
+		return fmt.Sprintf("%d-%d mins", min, max)
+	}
+}
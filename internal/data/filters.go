@@ -33,8 +33,13 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
-	// 检查 Sort 字段
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	// 检查 Sort 字段，多个排序字段用逗号分隔，例如 -year,title，每个字段都必须在安全列表中并且不能重复
+	columns := make([]string, 0, len(f.sortTerms()))
+	for _, term := range f.sortTerms() {
+		v.Check(validator.In(term, f.SortSafelist...), "sort", "invalid sort value")
+		columns = append(columns, strings.TrimPrefix(term, "-"))
+	}
+	v.Check(validator.Unique(columns), "sort", "must not contain duplicate columns")
 }
 
 // calculateMetadata 方法返回一个包含了元数据的 Metadata 结构体。
@@ -52,26 +57,43 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 }
 
-// sortColumn 方法返回排序列的名称，即数据库中的列名。
-func (f Filters) sortColumn() string {
+// sortTerms 方法返回 Sort 中以逗号分隔的各个排序字段。
+func (f Filters) sortTerms() []string {
+	return strings.Split(f.Sort, ",")
+}
+
+// sortColumn 方法返回排序字段对应的列名，即数据库中的列名。
+func (f Filters) sortColumn(term string) string {
 	for _, safeValue := range f.SortSafelist {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+		if term == safeValue {
+			return strings.TrimPrefix(term, "-")
 		}
 	}
 
 	// 直接 panic，防止 SQL 注入攻击
-	panic("unsafe sort parameter: " + f.Sort)
+	panic("unsafe sort parameter: " + term)
 }
 
-// sortDirection 方法返回排序方向，即 ASC 或 DESC。
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
+// sortDirection 方法返回排序字段的排序方向，即 ASC 或 DESC。
+func (f Filters) sortDirection(term string) string {
+	if strings.HasPrefix(term, "-") {
 		return "DESC" // descending
 	}
 	return "ASC" // ascending
 }
 
+// orderBy 方法返回 ORDER BY 子句的内容，例如 "year DESC, title ASC"。
+func (f Filters) orderBy() string {
+	terms := f.sortTerms()
+
+	clauses := make([]string, 0, len(terms))
+	for _, term := range terms {
+		clauses = append(clauses, f.sortColumn(term)+" "+f.sortDirection(term))
+	}
+
+	return strings.Join(clauses, ", ")
+}
+
 // limit 方法返回 LIMIT 子句的值。
 func (f Filters) limit() int {
 	return f.PageSize
@@ -0,0 +1,480 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// 导入的状态。上传完成之前为 uploading，之后由后台任务依次处理
+const (
+	ImportUploading = "uploading"
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// 导入文件的格式
+const (
+	ImportCSV    = "csv"
+	ImportNDJSON = "ndjson"
+)
+
+// ImportColumns 是 CSV 文件支持的列，也是 NDJSON 每一行支持的字段，只有 title 是必须的列
+var ImportColumns = []string{"external_id", "title", "year", "runtime", "genres"}
+
+// MovieImport 记录一次批量导入的进度，ProcessedRows 之前的行都已经处理完成
+type MovieImport struct {
+	ID            int64      `json:"id"`
+	UserID        int64      `json:"user_id"`
+	Format        string     `json:"format"`
+	DryRun        bool       `json:"dry_run"`
+	Status        string     `json:"status"`
+	TotalRows     int        `json:"total_rows"`
+	ProcessedRows int        `json:"processed_rows"`
+	CreatedRows   int        `json:"created_rows"` // 试运行时为将要创建的电影数量
+	UpdatedRows   int        `json:"updated_rows"` // 试运行时为将要更新的电影数量
+	FailedRows    int        `json:"failed_rows"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportRow 是导入文件中的一行，Number 从 1 开始，不包括 CSV 的标题行。
+// CSV 的行保存为以列名为键的对象，NDJSON 的行原样保存，不是有效 JSON 的行保存为 JSON 字符串。
+type ImportRow struct {
+	Number int               `json:"row"`
+	Data   json.RawMessage   `json:"data"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// MovieImportPayload 是 movie_import 任务的参数
+type MovieImportPayload struct {
+	ImportID int64 `json:"import_id"`
+}
+
+type MovieImportModel struct {
+	DB DBTX
+}
+
+// ValidateImportHeader 方法检查 CSV 文件的标题行，每一列都必须是 ImportColumns 之一并且不能重复。
+func ValidateImportHeader(v *validator.Validator, header []string) {
+	v.Check(validator.In("title", header...), "header", "must contain a title column")
+	v.Check(validator.Unique(header), "header", "must not contain duplicate columns")
+	for _, column := range header {
+		v.Check(validator.In(column, ImportColumns...), "header", fmt.Sprintf("unknown column %q", column))
+	}
+}
+
+// DecodeImportRow 将导入文件中的一行解析为电影，并使用 ValidateMovie 进行校验。
+// 返回的 externalID 为空时总是创建新的电影。这一行无效时 v 中包含错误。
+func DecodeImportRow(v *validator.Validator, format string, data json.RawMessage) (*Movie, string) {
+	var input struct {
+		ExternalID string   `json:"external_id"`
+		Title      string   `json:"title"`
+		Year       int32    `json:"year"`
+		Runtime    Runtime  `json:"runtime"`
+		Genres     []string `json:"genres"`
+	}
+
+	switch format {
+	case ImportNDJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&input)
+		if err != nil {
+			var unmarshalTypeError *json.UnmarshalTypeError
+
+			switch {
+			case errors.Is(err, ErrInvalidRuntimeFormat):
+				v.AddError("runtime", err.Error())
+			case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+				v.AddError(unmarshalTypeError.Field, "has an incorrect JSON type")
+			case errors.As(err, &unmarshalTypeError):
+				// 不是有效 JSON 的行保存为 JSON 字符串，所以也会走到这里
+				v.AddError("row", "must be a valid JSON object")
+			default:
+				v.AddError("row", err.Error())
+			}
+			return nil, ""
+		}
+
+	case ImportCSV:
+		var fields map[string]string
+
+		err := json.Unmarshal(data, &fields)
+		if err != nil {
+			// 列数与标题行不一致的行保存为数组
+			v.AddError("row", "must have the same number of fields as the header")
+			return nil, ""
+		}
+
+		input.ExternalID = fields["external_id"]
+		input.Title = fields["title"]
+
+		if s := strings.TrimSpace(fields["year"]); s != "" {
+			year, err := strconv.ParseInt(s, 10, 32)
+			if err != nil {
+				v.AddError("year", "must be an integer value")
+			}
+			input.Year = int32(year)
+		}
+
+		if s := strings.TrimSpace(fields["runtime"]); s != "" {
+			err := input.Runtime.UnmarshalJSON([]byte(strconv.Quote(s)))
+			if err != nil {
+				v.AddError("runtime", err.Error())
+			}
+		}
+
+		// 一个单元格中的多个类型用逗号分隔，例如 "drama,crime"
+		if s := strings.TrimSpace(fields["genres"]); s != "" {
+			input.Genres = []string{}
+			for _, genre := range strings.Split(s, ",") {
+				if genre = strings.TrimSpace(genre); genre != "" {
+					input.Genres = append(input.Genres, genre)
+				}
+			}
+		}
+
+	default:
+		panic("unknown import format: " + format)
+	}
+
+	v.Check(len(input.ExternalID) <= 255, "external_id", "must not be more than 255 bytes long")
+
+	movie := &Movie{
+		Title:   input.Title,
+		Year:    input.Year,
+		Runtime: input.Runtime,
+		Genres:  input.Genres,
+	}
+
+	ValidateMovie(v, movie)
+
+	return movie, input.ExternalID
+}
+
+// Insert 方法添加一条新的导入记录，状态为 uploading。
+func (m MovieImportModel) Insert(imp *MovieImport) error {
+	query := `
+		INSERT INTO movie_imports (user_id, format, dry_run)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, imp.UserID, imp.Format, imp.DryRun).Scan(&imp.ID, &imp.Status, &imp.CreatedAt, &imp.UpdatedAt)
+}
+
+// InsertRows 方法保存上传的一批行。
+func (m MovieImportModel) InsertRows(importID int64, rows []*ImportRow) error {
+	numbers := make([]int64, len(rows))
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		numbers[i] = int64(row.Number)
+		values[i] = string(row.Data)
+	}
+
+	query := `
+		INSERT INTO movie_import_rows (import_id, row_number, data)
+		SELECT $1, row_number, data::jsonb
+		FROM unnest($2::integer[], $3::text[]) AS rows (row_number, data)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, importID, pq.Array(numbers), pq.Array(values))
+	return err
+}
+
+// Start 方法在上传完成之后记录总行数，并将导入的状态改为 pending，等待后台任务处理。
+func (m MovieImportModel) Start(imp *MovieImport, totalRows int) error {
+	query := `
+		UPDATE movie_imports
+		SET status = 'pending', total_rows = $1, updated_at = NOW()
+		WHERE id = $2 AND status = 'uploading'
+		RETURNING status, total_rows, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, totalRows, imp.ID).Scan(&imp.Status, &imp.TotalRows, &imp.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get 方法返回指定 ID 的导入记录。
+func (m MovieImportModel) Get(id int64) (*MovieImport, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, format, dry_run, status, total_rows, processed_rows, created_rows, updated_rows,
+		       failed_rows, last_error, created_at, updated_at, finished_at
+		FROM movie_imports
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var imp MovieImport
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&imp.ID,
+		&imp.UserID,
+		&imp.Format,
+		&imp.DryRun,
+		&imp.Status,
+		&imp.TotalRows,
+		&imp.ProcessedRows,
+		&imp.CreatedRows,
+		&imp.UpdatedRows,
+		&imp.FailedRows,
+		&imp.LastError,
+		&imp.CreatedAt,
+		&imp.UpdatedAt,
+		&imp.FinishedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &imp, nil
+}
+
+// NextRows 方法返回 ProcessedRows 之后的最多 limit 行，没有剩余的行时返回空切片。
+func (m MovieImportModel) NextRows(imp *MovieImport, limit int) ([]*ImportRow, error) {
+	query := `
+		SELECT row_number, data
+		FROM movie_import_rows
+		WHERE import_id = $1 AND row_number > $2
+		ORDER BY row_number ASC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, imp.ID, imp.ProcessedRows, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var result []*ImportRow
+
+	for rows.Next() {
+		var row ImportRow
+		err := rows.Scan(&row.Number, &row.Data)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RecordBatch 方法记录一批行的处理结果：保存失败的行的错误，并更新进度和计数。
+// 导入的状态同时变为 running，lastRow 是这一批的最后一行。
+func (m MovieImportModel) RecordBatch(imp *MovieImport, lastRow, created, updated int, failed []*ImportRow) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	for _, row := range failed {
+		js, err := json.Marshal(row.Errors)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE movie_import_rows
+			SET errors = $1
+			WHERE import_id = $2 AND row_number = $3`
+
+		_, err = m.DB.ExecContext(ctx, query, js, imp.ID, row.Number)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE movie_imports
+		SET status = 'running', processed_rows = $1, created_rows = created_rows + $2, updated_rows = updated_rows + $3,
+		    failed_rows = failed_rows + $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING status, processed_rows, created_rows, updated_rows, failed_rows, updated_at`
+
+	args := []any{lastRow, created, updated, len(failed), imp.ID}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&imp.Status,
+		&imp.ProcessedRows,
+		&imp.CreatedRows,
+		&imp.UpdatedRows,
+		&imp.FailedRows,
+		&imp.UpdatedAt,
+	)
+}
+
+// Finish 方法将导入标记为 completed 或者 failed，failed 时 lastError 记录失败的原因。
+func (m MovieImportModel) Finish(imp *MovieImport, status, lastError string) error {
+	// 导入结束后只有校验失败的行还需要通过 GetErrors 查看，其余的行连同原始数据一起删除
+	query := `
+		WITH purged AS (
+			DELETE FROM movie_import_rows
+			WHERE import_id = $3 AND errors IS NULL
+		)
+		UPDATE movie_imports
+		SET status = $1, last_error = $2, updated_at = NOW(), finished_at = NOW()
+		WHERE id = $3
+		RETURNING status, last_error, updated_at, finished_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, status, lastError, imp.ID).Scan(&imp.Status, &imp.LastError, &imp.UpdatedAt, &imp.FinishedAt)
+}
+
+// ExternalIDSeen 方法检查导入中 beforeRow 之前的有效行是否已经使用了 externalID，试运行时用来识别文件中重复的电影。
+func (m MovieImportModel) ExternalIDSeen(importID int64, beforeRow int, externalID string) (bool, error) {
+	if externalID == "" {
+		return false, nil
+	}
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM movie_import_rows
+			WHERE import_id = $1 AND row_number < $2 AND errors IS NULL
+			AND data->>'external_id' = $3
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var seen bool
+	err := m.DB.QueryRowContext(ctx, query, importID, beforeRow, externalID).Scan(&seen)
+	return seen, err
+}
+
+// PurgeRows 方法删除结束时间早于 olderThan 之前的导入中剩余的行（即校验失败的行），返回删除的行数。
+// 导入记录本身和统计数据会保留。
+func (m MovieImportModel) PurgeRows(olderThan time.Duration) (int64, error) {
+	query := `
+		DELETE FROM movie_import_rows
+		USING movie_imports
+		WHERE movie_import_rows.import_id = movie_imports.id
+		AND movie_imports.finished_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Delete 方法删除导入记录以及它的所有行，用于上传失败时清理。
+func (m MovieImportModel) Delete(id int64) error {
+	query := `
+		DELETE FROM movie_imports
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// GetErrors 方法返回导入中校验失败的行以及它们的错误，按行号排序。
+func (m MovieImportModel) GetErrors(importID int64, filters Filters) ([]*ImportRow, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), row_number, data, errors
+		FROM movie_import_rows
+		WHERE import_id = $1 AND errors IS NOT NULL
+		ORDER BY %s
+		LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, importID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var totalRecords int
+	var result []*ImportRow
+
+	for rows.Next() {
+		var row ImportRow
+		var errs []byte
+		err := rows.Scan(&totalRecords, &row.Number, &row.Data, &errs)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(errs, &row.Errors)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		result = append(result, &row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return result, metadata, nil
+}
@@ -0,0 +1,288 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// 任务的状态
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobDead      = "dead" // 重试次数用尽，等待管理员处理
+)
+
+// 任务的类型
+const (
+	JobWelcomeEmail = "welcome_email"
+	JobMovieImport  = "movie_import"
+)
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// WelcomeEmailPayload 是 welcome_email 任务的参数
+type WelcomeEmailPayload struct {
+	UserID int64 `json:"user_id"`
+}
+
+type JobModel struct {
+	DB DBTX
+}
+
+// ValidateJobStatus 检查任务状态过滤条件是否有效
+func ValidateJobStatus(v *validator.Validator, status string) {
+	v.Check(status == "" || validator.In(status, JobPending, JobRunning, JobCompleted, JobDead), "status", "invalid status value")
+}
+
+// Enqueue 方法将一个新的任务添加到 jobs 数据表中，payload 会被编码为 JSON。
+func (m JobModel) Enqueue(kind string, payload any, maxAttempts int) (*Job, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		Kind:        kind,
+		Payload:     js,
+		Status:      JobPending,
+		MaxAttempts: maxAttempts,
+	}
+
+	query := `
+		INSERT INTO jobs (kind, payload, max_attempts)
+		VALUES ($1, $2, $3)
+		RETURNING id, run_at, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, kind, []byte(js), maxAttempts).Scan(&job.ID, &job.RunAt, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Claim 方法取出一个可以执行的任务，并将其标记为 running。
+// 处于 running 状态超过 lockTimeout 的任务被视为执行它的进程已经崩溃，会被重新取出；
+// 与 Fail 一样，重试次数已经用尽的任务不再取出，而是进入 dead 状态，避免导致崩溃的任务无限重试。
+// 没有可以执行的任务时返回 ErrRecordNotFound。
+func (m JobModel) Claim(lockTimeout time.Duration) (*Job, error) {
+	query := `
+		WITH expired AS (
+			UPDATE jobs
+			SET status = 'dead', locked_at = NULL, last_error = 'lock timeout exceeded', updated_at = NOW()
+			WHERE status = 'running' AND locked_at < NOW() - make_interval(secs => $1)
+			AND attempts >= max_attempts
+		)
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = 'pending' AND run_at <= NOW())
+			OR (status = 'running' AND locked_at < NOW() - make_interval(secs => $1) AND attempts < max_attempts)
+			ORDER BY run_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job Job
+
+	err := m.DB.QueryRowContext(ctx, query, lockTimeout.Seconds()).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// Complete 方法将任务标记为已完成。
+func (m JobModel) Complete(id int64) error {
+	query := `
+		UPDATE jobs
+		SET status = 'completed', locked_at = NULL, last_error = '', updated_at = NOW()
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// Fail 方法记录任务的错误。如果还有重试次数，任务会在 retryAt 之后重新执行，否则进入 dead 状态。
+func (m JobModel) Fail(job *Job, jobErr error, retryAt time.Time) error {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+		    run_at = $1, locked_at = NULL, last_error = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING status, run_at, last_error`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, retryAt, jobErr.Error(), job.ID).Scan(&job.Status, &job.RunAt, &job.LastError)
+}
+
+// Get 方法返回指定 ID 的任务。
+func (m JobModel) Get(id int64) (*Job, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at
+		FROM jobs
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job Job
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// GetAll 方法返回符合过滤条件的任务列表，status 和 kind 为空时不进行过滤。
+func (m JobModel) GetAll(status, kind string, filters Filters) ([]*Job, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at
+		FROM jobs
+		WHERE (status = $1 OR $1 = '')
+		AND (kind = $2 OR $2 = '')
+		ORDER BY %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, kind, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var totalRecords int
+	var jobs []*Job
+
+	for rows.Next() {
+		var job Job
+		err := rows.Scan(
+			&totalRecords,
+			&job.ID,
+			&job.Kind,
+			&job.Payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return jobs, metadata, nil
+}
+
+// Retry 方法将一个 dead 状态的任务重新放回队列，并重置重试次数。
+// 如果任务已经不处于 dead 状态，返回 ErrEditConflict。
+func (m JobModel) Retry(job *Job) error {
+	query := `
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = NOW(), last_error = '', updated_at = NOW()
+		WHERE id = $1 AND status = 'dead'
+		RETURNING status, attempts, run_at, last_error, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, job.ID).Scan(&job.Status, &job.Attempts, &job.RunAt, &job.LastError, &job.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
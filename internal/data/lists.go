@@ -0,0 +1,401 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// DefaultListName 是每个用户默认的待看列表的名称，自定义列表不能使用这个名称
+const DefaultListName = "Watchlist"
+
+var (
+	// ErrDuplicateListName 表示用户已经有一个同名的列表。
+	ErrDuplicateListName = errors.New("duplicate list name")
+)
+
+// List 是用户的电影列表，每个用户有一个默认的待看列表，也可以创建自定义的列表，公开的列表其他用户也可以查看
+type List struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	IsDefault bool      `json:"is_default"`
+	Public    bool      `json:"public"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+}
+
+// ListItem 是列表中的一部电影，Position 越小越靠前
+type ListItem struct {
+	Movie    *Movie    `json:"movie"`
+	Note     string    `json:"note,omitempty"`
+	Position int32     `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+type ListModel struct {
+	DB DBTX
+}
+
+// ValidateList 方法检查列表的名称是否有效。
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(list.IsDefault || !strings.EqualFold(list.Name, DefaultListName), "name", "is reserved for the default list")
+}
+
+// ValidateListItem 方法检查列表项的备注是否有效。
+func ValidateListItem(v *validator.Validator, item *ListItem) {
+	v.Check(len(item.Note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
+
+// Insert 方法添加一个新的自定义列表，用户已经有同名的列表时返回 ErrDuplicateListName。
+func (m ListModel) Insert(list *List) error {
+	query := `
+		INSERT INTO lists (user_id, name, public)
+		VALUES ($1, $2, $3)
+		RETURNING id, is_default, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, list.UserID, list.Name, list.Public).Scan(
+		&list.ID,
+		&list.IsDefault,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `unique constraint "lists_user_id_name_key"`):
+			return ErrDuplicateListName
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get 方法返回指定 ID 的列表。
+func (m ListModel) Get(id int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, name, is_default, public, created_at, updated_at, version
+		FROM lists
+		WHERE id = $1`
+
+	return m.getOne(query, id)
+}
+
+// InsertDefault 方法为用户创建默认的待看列表，用户已经有默认列表时什么也不做。注册时在创建用户的事务中调用。
+// 用户没有默认列表但已经有一个同名的列表时，将这个列表标记为默认列表，而不是因为名称冲突而跳过。
+func (m ListModel) InsertDefault(userID int64) error {
+	query := `
+		WITH promoted AS (
+			UPDATE lists
+			SET is_default = true, updated_at = NOW(), version = version + 1
+			WHERE user_id = $1 AND name = $2 AND NOT is_default
+			AND NOT EXISTS (SELECT 1 FROM lists WHERE user_id = $1 AND is_default)
+			RETURNING id
+		)
+		INSERT INTO lists (user_id, name, is_default)
+		SELECT $1, $2, true
+		WHERE NOT EXISTS (SELECT 1 FROM promoted)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, DefaultListName)
+	return err
+}
+
+// GetDefault 方法返回用户的默认待看列表。
+func (m ListModel) GetDefault(userID int64) (*List, error) {
+	query := `
+		SELECT id, user_id, name, is_default, public, created_at, updated_at, version
+		FROM lists
+		WHERE user_id = $1 AND is_default`
+
+	return m.getOne(query, userID)
+}
+
+// getOne 执行一个返回单个列表的查询
+func (m ListModel) getOne(query string, args ...any) (*List, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var list List
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&list.ID,
+		&list.UserID,
+		&list.Name,
+		&list.IsDefault,
+		&list.Public,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetAllForUser 方法返回用户的列表，publicOnly 为 true 时只返回公开的列表。
+func (m ListModel) GetAllForUser(userID int64, publicOnly bool, filters Filters) ([]*List, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, user_id, name, is_default, public, created_at, updated_at, version
+		FROM lists
+		WHERE user_id = $1
+		AND (public OR NOT $2)
+		ORDER BY is_default DESC, %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, publicOnly, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var totalRecords int
+	var lists []*List
+
+	for rows.Next() {
+		var list List
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.UserID,
+			&list.Name,
+			&list.IsDefault,
+			&list.Public,
+			&list.CreatedAt,
+			&list.UpdatedAt,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return lists, metadata, nil
+}
+
+// Update 方法更新列表的名称和可见性，通过 version 字段实现乐观并发控制。
+func (m ListModel) Update(list *List) error {
+	query := `
+		UPDATE lists
+		SET name = $1, public = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING updated_at, version`
+
+	args := []any{list.Name, list.Public, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `unique constraint "lists_user_id_name_key"`):
+			return ErrDuplicateListName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete 方法删除指定 ID 的自定义列表及其中的电影，默认列表不能删除。
+func (m ListModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM lists
+		WHERE id = $1 AND NOT is_default`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PutItem 方法将电影添加到列表中，电影已经在列表中时更新备注。
+// position 小于 0 时新添加的电影排在最后，已有的电影保持原来的位置；
+// 否则电影被放到 position，原来在这个位置及之后的电影依次后移。
+// 电影不存在时返回 ErrRecordNotFound。
+func (m ListModel) PutItem(listID, movieID int64, item *ListItem, position int32) error {
+	query := `
+		WITH shifted AS (
+			UPDATE list_items SET position = position + 1
+			WHERE list_id = $1 AND movie_id <> $2 AND $4 >= 0 AND position >= $4
+		)
+		INSERT INTO list_items (list_id, movie_id, note, position)
+		VALUES ($1, $2, $3, CASE
+			WHEN $4 >= 0 THEN $4
+			ELSE (SELECT COALESCE(MAX(position) + 1, 0) FROM list_items WHERE list_id = $1)
+		END)
+		ON CONFLICT (list_id, movie_id) DO UPDATE
+		SET note = EXCLUDED.note,
+		    position = CASE WHEN $4 >= 0 THEN EXCLUDED.position ELSE list_items.position END
+		RETURNING position, added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, listID, movieID, item.Note, position).Scan(&item.Position, &item.AddedAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `foreign key constraint "list_items_movie_id_fkey"`):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveItem 方法将电影从列表中移除，电影不在列表中时返回 ErrRecordNotFound。
+func (m ListModel) RemoveItem(listID, movieID int64) error {
+	query := `
+		DELETE FROM list_items
+		WHERE list_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, listID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetItems 方法返回列表中的电影。
+func (m ListModel) GetItems(listID int64, filters Filters) ([]*ListItem, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), list_items.note, list_items.position, list_items.added_at,
+		       movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+		       movies.rating, movies.rating_count, movies.version
+		FROM list_items
+		INNER JOIN movies ON movies.id = list_items.movie_id
+		WHERE list_items.list_id = $1
+		ORDER BY %s, movies.id ASC
+		LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var totalRecords int
+	var items []*ListItem
+
+	for rows.Next() {
+		item := ListItem{Movie: &Movie{}}
+		err := rows.Scan(
+			&totalRecords,
+			&item.Note,
+			&item.Position,
+			&item.AddedAt,
+			&item.Movie.ID,
+			&item.Movie.CreatedAt,
+			&item.Movie.Title,
+			&item.Movie.Year,
+			&item.Movie.Runtime,
+			pq.Array(&item.Movie.Genres),
+			&item.Movie.Rating,
+			&item.Movie.RatingCount,
+			&item.Movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return items, metadata, nil
+}
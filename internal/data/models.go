@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -12,20 +13,74 @@ var (
 	ErrEditConflict = errors.New("edit conflict")
 )
 
+// DBTX 是 *sql.DB 和 *sql.Tx 共有的方法，模型通过它执行查询，这样同一个模型既可以直接使用连接池，也可以在事务中使用
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 // Models 定义一个模型结构体，包含所有模型的实例
 type Models struct {
 	Movies      MovieModel
+	Reviews     ReviewModel
+	People      PersonModel
+	Credits     CreditModel
+	Imports     MovieImportModel
+	Lists       ListModel
+	Watched     WatchedModel
 	Tokens      TokenModel
 	Users       UserModel
 	Permissions PermissionModel
+	Jobs        JobModel
+	Emails      EmailModel
+	Suppression SuppressionModel
+	Scheduled   ScheduledTaskModel
+
+	db *sql.DB
 }
 
 // NewModels 函数返回一个包含所有模型的 Models 结构体实例
 func NewModels(db *sql.DB) Models {
+	models := newModels(db)
+	models.Scheduled = ScheduledTaskModel{DB: db}
+	models.db = db
+	return models
+}
+
+// newModels 返回使用 db 执行查询的模型
+func newModels(db DBTX) Models {
 	return Models{
 		Movies:      MovieModel{DB: db},
+		Reviews:     ReviewModel{DB: db},
+		People:      PersonModel{DB: db},
+		Credits:     CreditModel{DB: db},
+		Imports:     MovieImportModel{DB: db},
+		Lists:       ListModel{DB: db},
+		Watched:     WatchedModel{DB: db},
 		Tokens:      TokenModel{DB: db},
 		Users:       UserModel{DB: db},
 		Permissions: PermissionModel{DB: db},
+		Jobs:        JobModel{DB: db},
+		Emails:      EmailModel{DB: db},
+		Suppression: SuppressionModel{DB: db},
 	}
 }
+
+// Transact 方法在一个事务中执行 fn，fn 通过参数 tx 中的模型执行的查询都属于这个事务。
+// fn 返回错误时回滚事务并原样返回这个错误，否则提交事务。
+// 定时任务的 advisory lock 需要独占连接，不能在事务中使用，所以 tx 中没有 Scheduled。
+func (m Models) Transact(fn func(tx Models) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(newModels(tx))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
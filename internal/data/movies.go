@@ -13,17 +13,21 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Title       string    `json:"title"`
+	Year        int32     `json:"year,omitempty"`
+	Runtime     Runtime   `json:"runtime,omitempty"`
+	Genres      []string  `json:"genres,omitempty"`
+	Highlight   string    `json:"highlight,omitempty"` // 搜索时 HTML 转义之后的标题，匹配的部分用 <mark> 标记
+	Rating      float64   `json:"rating,omitempty"`    // 平均评分，没有评价时为 0
+	RatingCount int32     `json:"rating_count"`
+	Version     int32     `json:"version"`
+	Credits     *Credits  `json:"credits,omitempty"` // 演职员表，只在请求时加载
 }
 
 type MovieModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 // ValidateMovie 方法检查电影结构体中的值是否有效。如果有错误，方法会将错误添加到 v.Errors 中。
@@ -79,7 +83,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	}
 
 	query := `
-	SELECT id, created_at, title, year, runtime, genres, version
+	SELECT id, created_at, title, year, runtime, genres, rating, rating_count, version
 	FROM movies
 	WHERE id = $1`
 
@@ -97,6 +101,8 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Year,
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
+		&movie.Rating,
+		&movie.RatingCount,
 		&movie.Version,
 	)
 
@@ -114,22 +120,141 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-// GetAll 方法返回所有电影的列表。
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// MovieFilters 是电影列表的筛选条件，每个字段的零值表示不按该字段筛选。
+type MovieFilters struct {
+	Title        string    // 标题全文搜索，语法见 searchQuery
+	Language     string    // 全文搜索使用的文本搜索配置，必须是 SearchLanguages 之一，为空时使用 simple
+	Genres       []string  // 包含所有这些类型
+	GenresAny    []string  // 至少包含其中一个类型
+	GenresNot    []string  // 不包含其中任何一个类型
+	YearMin      int32     // 上映年份的下限（包含）
+	YearMax      int32     // 上映年份的上限（包含）
+	RuntimeMin   Runtime   // 时长的下限（包含）
+	RuntimeMax   Runtime   // 时长的上限（包含）
+	CreatedAfter time.Time // 只返回在这个时间之后添加的电影
+	PersonID     int64     // 只返回该人物参与的电影
+	Role         string    // 与 PersonID 一起使用，限定人物的职位
+}
+
+// ValidateMovieFilters 方法检查电影的筛选条件是否有效。
+func ValidateMovieFilters(v *validator.Validator, f MovieFilters) {
+	v.Check(f.Title == "" || searchQuery(f.Title) != "", "title", "must contain at least one word")
+	v.Check(len(f.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(f.Language == "" || validator.In(f.Language, SearchLanguages...), "lang", "unsupported search language")
+
+	maxYear := int32(time.Now().Year())
+
+	if f.YearMin != 0 {
+		v.Check(f.YearMin >= 1888 && f.YearMin <= maxYear, "year_min", fmt.Sprintf("must be between 1888 and %d", maxYear))
+	}
+	if f.YearMax != 0 {
+		v.Check(f.YearMax >= 1888 && f.YearMax <= maxYear, "year_max", fmt.Sprintf("must be between 1888 and %d", maxYear))
+	}
+	if f.YearMin != 0 && f.YearMax != 0 {
+		v.Check(f.YearMin <= f.YearMax, "year_min", "must not be greater than year_max")
+	}
+
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	if f.RuntimeMin != 0 && f.RuntimeMax != 0 {
+		v.Check(f.RuntimeMin <= f.RuntimeMax, "runtime_min", "must not be greater than runtime_max")
+	}
+
+	for key, genres := range map[string][]string{"genres": f.Genres, "genres_any": f.GenresAny, "genres_not": f.GenresNot} {
+		v.Check(len(genres) <= 10, key, "must not contain more than 10 genres")
+		v.Check(!validator.In("", genres...), key, "must not contain empty values")
+	}
+	for _, genre := range f.GenresNot {
+		v.Check(!validator.In(genre, f.Genres...) && !validator.In(genre, f.GenresAny...), "genres_not", "must not overlap with genres or genres_any")
+	}
+
+	v.Check(!f.CreatedAfter.After(time.Now()), "created_after", "must not be in the future")
+
+	v.Check(f.PersonID >= 0, "person", "must be a positive integer")
+	if f.Role != "" {
+		v.Check(f.PersonID != 0, "role", "must be used together with person")
+		v.Check(validator.In(f.Role, CreditRoles...), "role", "must be one of director, actor or writer")
+	}
+}
+
+// movieFiltersSQL 是 MovieFilters 对应的 WHERE 条件，占位符 $1 到 $11 依次对应 MovieFilters.args() 返回的参数，
+// %[1]s 是文本搜索配置。筛选值全部通过占位符传递，文本搜索配置来自安全列表，所以不会有 SQL 注入的问题。
+const movieFiltersSQL = `
+        (to_tsvector('%[1]s', title) @@ to_tsquery('%[1]s', $1) OR $1 = '')
+        AND (genres @> $2 OR $2 = '{}')
+        AND (genres && $3 OR $3 = '{}')
+        AND (NOT genres && $4 OR $4 = '{}')
+        AND (year >= $5 OR $5 = 0)
+        AND (year <= $6 OR $6 = 0)
+        AND (runtime >= $7 OR $7 = 0)
+        AND (runtime <= $8 OR $8 = 0)
+        AND (created_at > $9 OR $9 IS NULL)
+        AND ($10 = 0 OR id IN (SELECT movie_id FROM credits WHERE person_id = $10 AND (role = $11 OR $11 = '')))`
+
+// language 方法返回全文搜索使用的文本搜索配置。
+func (f MovieFilters) language() string {
+	if f.Language == "" {
+		return "simple"
+	}
+
+	if !validator.In(f.Language, SearchLanguages...) {
+		// 直接 panic，防止 SQL 注入攻击
+		panic("unsafe search language: " + f.Language)
+	}
+
+	return f.Language
+}
+
+// where 方法返回 WHERE 子句的条件。
+func (f MovieFilters) where() string {
+	return fmt.Sprintf(movieFiltersSQL, f.language())
+}
+
+// args 方法返回 movieFiltersSQL 中占位符对应的参数。
+func (f MovieFilters) args() []any {
+	// 没有设置 CreatedAfter 时传递 NULL
+	var createdAfter *time.Time
+	if !f.CreatedAfter.IsZero() {
+		createdAfter = &f.CreatedAfter
+	}
+
+	return []any{
+		searchQuery(f.Title),
+		pq.Array(nonNil(f.Genres)),
+		pq.Array(nonNil(f.GenresAny)),
+		pq.Array(nonNil(f.GenresNot)),
+		f.YearMin,
+		f.YearMax,
+		f.RuntimeMin,
+		f.RuntimeMax,
+		createdAfter,
+		f.PersonID,
+		f.Role,
+	}
+}
+
+// nonNil 将 nil 切片转换为空切片，这样 pq.Array 传递的是 '{}' 而不是 NULL
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// GetAll 方法返回符合筛选条件的电影列表。
+// 按标题搜索时，结果带有高亮的标题，并且可以按 relevance 排序，即按 ts_rank 计算的相关度从高到低排序。
+func (m MovieModel) GetAll(movieFilters MovieFilters, filters Filters) ([]*Movie, Metadata, error) {
+	// relevance 取 ts_rank 的负值，这样升序排列时相关度最高的电影排在最前面
 	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+        SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, rating, rating_count, version,
+               CASE WHEN $1 = '' THEN '' ELSE ts_headline('%[1]s', translate(title, chr(2) || chr(3), ''), to_tsquery('%[1]s', $1), 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', HighlightAll=true') END,
+               CASE WHEN $1 = '' THEN 0 ELSE -ts_rank(to_tsvector('%[1]s', title), to_tsquery('%[1]s', $1)) END AS relevance
         FROM movies
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
-        AND (genres @> $2 OR $2 = '{}')     
-        ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+        WHERE %[2]s
+        ORDER BY %[3]s, id ASC
+        LIMIT $12 OFFSET $13`, movieFilters.language(), movieFilters.where(), filters.orderBy())
 
-	args := []any{
-		title,
-		pq.Array(genres),
-		filters.limit(),
-		filters.offset(),
-	}
+	args := append(movieFilters.args(), filters.limit(), filters.offset())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -151,6 +276,7 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 
 	for rows.Next() {
 		var movie Movie
+		var relevance float64
 		err := rows.Scan(
 			&totalRecords,
 			&movie.ID,
@@ -159,11 +285,16 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Year,
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
+			&movie.Rating,
+			&movie.RatingCount,
 			&movie.Version,
+			&movie.Highlight,
+			&relevance,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		movie.Highlight = highlightHTML(movie.Highlight)
 		movies = append(movies, &movie)
 	}
 
@@ -176,6 +307,97 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	return movies, metadata, nil
 }
 
+// DidYouMean 方法返回与 text 最相似的电影标题，用于搜索没有结果时提示用户可能想搜索的内容。
+// 使用 pg_trgm 的三元组相似度匹配，所以拼写错误的词也能找到结果。
+func (m MovieModel) DidYouMean(text string) ([]string, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	query := `
+        SELECT title
+        FROM movies
+        WHERE $1 <% title
+        GROUP BY title
+        ORDER BY max(word_similarity($1, title)) DESC, title ASC
+        LIMIT 5`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, text)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var titles []string
+
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			return nil, err
+		}
+		titles = append(titles, title)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return titles, nil
+}
+
+// Upsert 方法按照 externalID 添加或者更新一部电影，返回的 created 表示是否添加了新的电影。
+// externalID 为空时总是添加新的电影。
+func (m MovieModel) Upsert(movie *Movie, externalID string) (created bool, err error) {
+	// xmax 为 0 说明这一行是新插入的，而不是由 ON CONFLICT 更新的
+	query := `
+	INSERT INTO movies (title, year, runtime, genres, external_id)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+	ON CONFLICT (external_id) DO UPDATE
+	SET title = EXCLUDED.title, year = EXCLUDED.year, runtime = EXCLUDED.runtime, genres = EXCLUDED.genres,
+	    version = movies.version + 1
+	RETURNING id, created_at, version, xmax = 0`
+
+	args := []any{
+		movie.Title,
+		movie.Year,
+		movie.Runtime,
+		pq.Array(movie.Genres),
+		externalID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version, &created)
+	return created, err
+}
+
+// ExternalIDExists 方法检查是否已经有电影使用了 externalID，用于导入的试运行。
+func (m MovieModel) ExternalIDExists(externalID string) (bool, error) {
+	if externalID == "" {
+		return false, nil
+	}
+
+	query := `
+	SELECT EXISTS (SELECT 1 FROM movies WHERE external_id = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, externalID).Scan(&exists)
+	return exists, err
+}
+
 // Update 方法用来更新指定 ID 的电影信息。
 func (m MovieModel) Update(movie *Movie) error {
 	query := `
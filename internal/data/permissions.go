@@ -22,7 +22,7 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 // GetAllForUser 返回指定用户的权限列表
@@ -0,0 +1,167 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// 定时任务的执行结果
+const (
+	ScheduledTaskSucceeded = "succeeded"
+	ScheduledTaskFailed    = "failed"
+)
+
+// ScheduledTask 记录一个定时任务最近一次的执行情况
+type ScheduledTask struct {
+	Name             string        `json:"name"`
+	LastRunAt        time.Time     `json:"last_run_at"`
+	LastStatus       string        `json:"last_status"`
+	LastError        string        `json:"last_error,omitempty"`
+	LastDuration     time.Duration `json:"-"`
+	LastDurationMS   int64         `json:"last_duration_ms"`
+	LastAffectedRows int64         `json:"last_affected_rows"`
+}
+
+type ScheduledTaskModel struct {
+	DB *sql.DB
+}
+
+// TryLock 方法尝试获取以 name 命名的 PostgreSQL 会话级 advisory lock，用来保证多个实例中只有一个在执行同一个定时任务。
+// 获取成功时返回的 release 函数会释放锁并归还数据库连接；锁被其它实例持有时 acquired 为 false。
+func (m ScheduledTaskModel) TryLock(name string) (release func(), acquired bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// advisory lock 属于会话，所以加锁和解锁必须使用同一个连接
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&acquired)
+	if err != nil || !acquired {
+		_ = conn.Close()
+		return nil, false, err
+	}
+
+	release = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		_, _ = conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, name)
+		_ = conn.Close()
+	}
+
+	return release, true, nil
+}
+
+// Get 方法返回指定名称的定时任务最近一次的执行情况。
+func (m ScheduledTaskModel) Get(name string) (*ScheduledTask, error) {
+	query := `
+		SELECT name, last_run_at, last_status, last_error, last_duration_ms, last_affected_rows
+		FROM scheduled_tasks
+		WHERE name = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var task ScheduledTask
+
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(
+		&task.Name,
+		&task.LastRunAt,
+		&task.LastStatus,
+		&task.LastError,
+		&task.LastDurationMS,
+		&task.LastAffectedRows,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	task.LastDuration = time.Duration(task.LastDurationMS) * time.Millisecond
+
+	return &task, nil
+}
+
+// GetAll 方法返回所有定时任务最近一次的执行情况。
+func (m ScheduledTaskModel) GetAll() ([]*ScheduledTask, error) {
+	query := `
+		SELECT name, last_run_at, last_status, last_error, last_duration_ms, last_affected_rows
+		FROM scheduled_tasks
+		ORDER BY name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	tasks := []*ScheduledTask{}
+
+	for rows.Next() {
+		var task ScheduledTask
+		err := rows.Scan(
+			&task.Name,
+			&task.LastRunAt,
+			&task.LastStatus,
+			&task.LastError,
+			&task.LastDurationMS,
+			&task.LastAffectedRows,
+		)
+		if err != nil {
+			return nil, err
+		}
+		task.LastDuration = time.Duration(task.LastDurationMS) * time.Millisecond
+		tasks = append(tasks, &task)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// RecordRun 方法保存定时任务最近一次的执行情况。
+func (m ScheduledTaskModel) RecordRun(task *ScheduledTask) error {
+	query := `
+		INSERT INTO scheduled_tasks (name, last_run_at, last_status, last_error, last_duration_ms, last_affected_rows)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE
+		SET last_run_at = EXCLUDED.last_run_at, last_status = EXCLUDED.last_status, last_error = EXCLUDED.last_error,
+		    last_duration_ms = EXCLUDED.last_duration_ms, last_affected_rows = EXCLUDED.last_affected_rows`
+
+	task.LastDurationMS = task.LastDuration.Milliseconds()
+
+	args := []any{
+		task.Name,
+		task.LastRunAt,
+		task.LastStatus,
+		task.LastError,
+		task.LastDurationMS,
+		task.LastAffectedRows,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ts_headline 用控制字符 STX 和 ETX 标记标题中匹配的部分，标题中原有的这两个字符在查询中会被删除，
+// 所以结果中的标记都来自 ts_headline
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// highlightHTML 将 ts_headline 的结果转换为 HTML：先对标题进行转义，再将标记替换为 <mark>，
+// 这样标题中的 HTML 标签会作为文本显示，而不会被客户端渲染
+func highlightHTML(s string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(s))
+}
+
+// SearchLanguages 是全文搜索支持的 PostgreSQL 文本搜索配置，simple 不做词干提取，适用于任何语言。
+// 每个配置在 movies.title 上都有对应的 GIN 索引，添加新的语言时需要同时添加索引。
+var SearchLanguages = []string{"simple", "english", "french", "german", "spanish", "italian", "portuguese", "russian"}
+
+// searchToken 是搜索语句中的一个词或者一个用双引号括起来的短语
+type searchToken struct {
+	words  []string // 只包含字母和数字的词
+	prefix bool     // 以 * 结尾，匹配前缀
+	negate bool     // 以 - 开头，排除包含这个词的结果
+	or     bool     // OR 关键字，表示前后两个条件满足其一即可
+}
+
+// tokenizeSearch 将搜索语句拆分为词、短语和 OR 关键字
+func tokenizeSearch(s string) []searchToken {
+	var tokens []searchToken
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		var token searchToken
+
+		if strings.HasPrefix(s, "-") {
+			token.negate = true
+			s = s[1:]
+		}
+
+		var text string
+		if strings.HasPrefix(s, `"`) {
+			// 没有闭合的引号一直到语句结尾
+			var found bool
+			text, s, found = strings.Cut(s[1:], `"`)
+			if !found {
+				s = ""
+			}
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			text, s = s[:end], s[end:]
+
+			if text == "OR" && !token.negate {
+				tokens = append(tokens, searchToken{or: true})
+				continue
+			}
+
+			text, token.prefix = strings.CutSuffix(text, "*")
+		}
+
+		// 例如 spider-man 中的 - 不是运算符，拆分后作为短语 spider <-> man 匹配
+		token.words = strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if len(token.words) > 0 {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens
+}
+
+// searchQuery 将用户输入的搜索语句转换为 to_tsquery 的语法。支持以下语法：
+//
+//	star wars        同时包含 star 和 wars
+//	"star wars"      包含短语 star wars
+//	sta*             包含以 sta 开头的词
+//	-empire          不包含 empire
+//	alien OR aliens  包含 alien 或者 aliens
+//
+// 每个词只包含字母和数字，并且用单引号括起来，所以用户输入不会被解释为 tsquery 的运算符。
+func searchQuery(s string) string {
+	var b strings.Builder
+	pendingOr := false
+
+	for _, token := range tokenizeSearch(s) {
+		if token.or {
+			pendingOr = b.Len() > 0
+			continue
+		}
+
+		lexemes := make([]string, len(token.words))
+		for i, word := range token.words {
+			lexemes[i] = "'" + word + "'"
+		}
+		if token.prefix {
+			lexemes[len(lexemes)-1] += ":*"
+		}
+
+		expr := strings.Join(lexemes, " <-> ")
+		if len(lexemes) > 1 {
+			expr = "(" + expr + ")"
+		}
+		if token.negate {
+			expr = "!" + expr
+		}
+
+		if b.Len() > 0 {
+			if pendingOr {
+				b.WriteString(" | ")
+			} else {
+				b.WriteString(" & ")
+			}
+		}
+		b.WriteString(expr)
+		pendingOr = false
+	}
+
+	return b.String()
+}
+
+// SearchText 返回搜索语句中所有没有被排除的词，用空格分隔，用于三元组（trigram）相似度匹配
+func SearchText(s string) string {
+	var words []string
+	for _, token := range tokenizeSearch(s) {
+		if !token.negate {
+			words = append(words, token.words...)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// prefixQuery 将用户正在输入的内容转换为 to_tsquery 的语法，所有的词都必须出现，最后一个词可能还没有输入完，所以按前缀匹配。
+// 例如 "star wa" 转换为 'star' & 'wa':*
+func prefixQuery(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	lexemes := make([]string, len(words))
+	for i, word := range words {
+		lexemes[i] = "'" + word + "'"
+	}
+	lexemes[len(lexemes)-1] += ":*"
+
+	return strings.Join(lexemes, " & ")
+}
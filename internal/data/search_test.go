@@ -0,0 +1,25 @@
+package data
+
+import "testing"
+
+func TestHighlightHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "The \x02Matrix\x03", "The <mark>Matrix</mark>"},
+		{"no match", "Black Panther", "Black Panther"},
+		{"html in title", "<img src=x onerror=alert(1)> \x02Rocky\x03 & Co", "&lt;img src=x onerror=alert(1)&gt; <mark>Rocky</mark> &amp; Co"},
+		{"match inside tag", "<\x02script\x03>", "&lt;<mark>script</mark>&gt;"},
+		{"quotes", "\"\x02Heat\x03\" '95", "&#34;<mark>Heat</mark>&#34; &#39;95"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlightHTML(tt.in); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
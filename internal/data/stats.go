@@ -0,0 +1,144 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// StatsDimensions 是电影统计支持的分组维度，added 按添加时间分组，时间粒度由 interval 决定
+var StatsDimensions = []string{"year", "decade", "genre", "added"}
+
+// StatsIntervals 是按添加时间分组时支持的时间粒度
+var StatsIntervals = []string{"day", "week", "month", "year"}
+
+// statsDimensionSQL 是每个分组维度对应的 SQL 表达式，$12 是时间粒度
+var statsDimensionSQL = map[string]string{
+	"year":   "year::text",
+	"decade": "(year / 10 * 10)::text || 's'",
+	"genre":  "genre",
+	"added":  "to_char(date_trunc($12, created_at), 'YYYY-MM-DD')",
+}
+
+// maxStatsGroups 是统计结果中最多返回的分组数量
+const maxStatsGroups = 1000
+
+// MovieStats 是一组电影的汇总数据，AvgRating 只计算有评价的电影
+type MovieStats struct {
+	Count      int     `json:"count"`
+	AvgRuntime float64 `json:"avg_runtime"`
+	AvgRating  float64 `json:"avg_rating"`
+}
+
+// MovieStatsGroup 是一个分组的汇总数据，Key 是每个分组维度的值，例如 {"decade": "1990s", "genre": "drama"}
+type MovieStatsGroup struct {
+	Key map[string]string `json:"key"`
+	MovieStats
+}
+
+// ValidateStatsQuery 方法检查分组维度和时间粒度是否有效。
+func ValidateStatsQuery(v *validator.Validator, groupBy []string, interval string) {
+	v.Check(len(groupBy) <= 2, "group_by", "must not contain more than 2 dimensions")
+	v.Check(validator.Unique(groupBy), "group_by", "must not contain duplicate values")
+	for _, dimension := range groupBy {
+		v.Check(validator.In(dimension, StatsDimensions...), "group_by", "must only contain year, decade, genre or added")
+	}
+	v.Check(validator.In(interval, StatsIntervals...), "interval", "must be one of day, week, month or year")
+}
+
+// Stats 方法返回符合筛选条件的电影的汇总数据，以及按 groupBy 中的维度分组的汇总数据。
+// 按类型分组时，一部有多个类型的电影会计入每个类型的分组。
+func (m MovieModel) Stats(movieFilters MovieFilters, groupBy []string, interval string) (*MovieStats, []*MovieStatsGroup, error) {
+	aggregates := `count(*), coalesce(round(avg(runtime), 1), 0), coalesce(round(avg(rating) FILTER (WHERE rating_count > 0), 2), 0)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var total MovieStats
+
+	query := fmt.Sprintf(`
+        SELECT %s
+        FROM movies
+        WHERE %s`, aggregates, movieFilters.where())
+
+	err := m.DB.QueryRowContext(ctx, query, movieFilters.args()...).Scan(&total.Count, &total.AvgRuntime, &total.AvgRating)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	groups := []*MovieStatsGroup{}
+	if len(groupBy) == 0 {
+		return &total, groups, nil
+	}
+
+	args := movieFilters.args()
+	from := "movies"
+
+	columns := make([]string, len(groupBy))
+	for i, dimension := range groupBy {
+		column, ok := statsDimensionSQL[dimension]
+		if !ok {
+			// 直接 panic，防止 SQL 注入攻击
+			panic("unsafe stats dimension: " + dimension)
+		}
+		columns[i] = column
+
+		switch dimension {
+		case "genre":
+			from = "movies, unnest(genres) AS genre"
+		case "added":
+			args = append(args, interval)
+		}
+	}
+
+	query = fmt.Sprintf(`
+        SELECT %[1]s, %[2]s
+        FROM %[3]s
+        WHERE %[4]s
+        GROUP BY %[1]s
+        ORDER BY %[1]s
+        LIMIT %[5]d`, strings.Join(columns, ", "), aggregates, from, movieFilters.where(), maxStatsGroups)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	for rows.Next() {
+		values := make([]string, len(groupBy))
+		group := MovieStatsGroup{Key: make(map[string]string, len(groupBy))}
+
+		dest := make([]any, 0, len(groupBy)+3)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &group.Count, &group.AvgRuntime, &group.AvgRating)
+
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i, dimension := range groupBy {
+			group.Key[dimension] = values[i]
+		}
+		groups = append(groups, &group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return &total, groups, nil
+}
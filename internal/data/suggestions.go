@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// MovieSuggestion 是搜索建议中的一部电影，只包含显示建议所需的字段
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year,omitempty"`
+}
+
+// GenreSuggestion 是搜索建议中的一个类型，Count 是该类型的电影数量
+type GenreSuggestion struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+// SuggestMovies 方法返回最多 limit 部标题与 q 匹配的电影，用于用户输入时的自动补全。
+// 标题以 q 开头的电影排在最前面，其次是按词的前缀匹配的电影，最后是三元组相似度匹配（允许拼写错误）的电影。
+func (m MovieModel) SuggestMovies(q string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+		SELECT id, title, year
+		FROM movies
+		WHERE ($1 <> '' AND to_tsvector('simple', title) @@ to_tsquery('simple', $1))
+		OR $2 <% title
+		ORDER BY starts_with(lower(title), lower($2)) DESC,
+		         ($1 <> '' AND to_tsvector('simple', title) @@ to_tsquery('simple', $1)) DESC,
+		         word_similarity($2, title) DESC,
+		         rating_count DESC,
+		         id ASC
+		LIMIT $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, prefixQuery(q), strings.TrimSpace(q), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	suggestions := []*MovieSuggestion{}
+
+	for rows.Next() {
+		var suggestion MovieSuggestion
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// SuggestGenres 方法返回最多 limit 个以 q 开头的电影类型，电影数量多的类型排在前面。
+func (m MovieModel) SuggestGenres(q string, limit int) ([]*GenreSuggestion, error) {
+	query := `
+		SELECT genre, count(*)
+		FROM movies, unnest(genres) AS genre
+		WHERE starts_with(lower(genre), lower($1))
+		GROUP BY genre
+		ORDER BY count(*) DESC, genre ASC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, strings.TrimSpace(q), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	suggestions := []*GenreSuggestion{}
+
+	for rows.Next() {
+		var suggestion GenreSuggestion
+		err := rows.Scan(&suggestion.Genre, &suggestion.Count)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
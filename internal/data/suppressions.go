@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// 禁止发送的原因
+const (
+	SuppressionBounced      = "bounced"      // 地址不存在或者邮箱已满，任何邮件都不再发送
+	SuppressionComplained   = "complained"   // 收件人将邮件标记为垃圾邮件，任何邮件都不再发送
+	SuppressionUnsubscribed = "unsubscribed" // 收件人退订，只停止发送非事务性邮件
+	SuppressionManual       = "manual"       // 管理员手动添加，任何邮件都不再发送
+)
+
+// EmailSuppression 是禁止发送名单中的一个地址，地址统一保存为小写
+type EmailSuppression struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SuppressionModel struct {
+	DB DBTX
+}
+
+func ValidateSuppression(v *validator.Validator, suppression *EmailSuppression) {
+	ValidateEmail(v, suppression.Email)
+	v.Check(validator.In(suppression.Reason, SuppressionBounced, SuppressionComplained, SuppressionUnsubscribed, SuppressionManual),
+		"reason", "must be bounced, complained, unsubscribed or manual")
+}
+
+// Insert 方法将地址添加到禁止发送名单中。地址已经存在时只会将 unsubscribed 升级为更严格的原因，
+// 不会反过来把 bounced、complained 或 manual 降级为 unsubscribed，否则事务性邮件会重新发送给这个地址。
+// suppression.Reason 会被更新为名单中实际保存的原因。
+func (m SuppressionModel) Insert(suppression *EmailSuppression) error {
+	query := `
+		INSERT INTO email_suppressions (email, reason)
+		VALUES (lower($1), $2)
+		ON CONFLICT (email) DO UPDATE
+		SET reason = CASE WHEN email_suppressions.reason = 'unsubscribed' THEN EXCLUDED.reason ELSE email_suppressions.reason END
+		RETURNING email, reason, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, suppression.Email, suppression.Reason).Scan(&suppression.Email, &suppression.Reason, &suppression.CreatedAt)
+}
+
+// Set 方法供管理员添加地址或修改已有地址的原因，地址已经存在时总是使用 suppression.Reason 覆盖原来的原因。
+// 返回的 created 表示地址是否是新添加的。
+func (m SuppressionModel) Set(suppression *EmailSuppression) (bool, error) {
+	// 新插入的行的 xmax 为 0，被 ON CONFLICT 更新的行不为 0
+	query := `
+		INSERT INTO email_suppressions (email, reason)
+		VALUES (lower($1), $2)
+		ON CONFLICT (email) DO UPDATE
+		SET reason = EXCLUDED.reason
+		RETURNING email, reason, created_at, xmax = 0`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var created bool
+	err := m.DB.QueryRowContext(ctx, query, suppression.Email, suppression.Reason).Scan(&suppression.Email, &suppression.Reason, &suppression.CreatedAt, &created)
+	return created, err
+}
+
+// Suppressed 方法检查是否禁止向 email 发送 category 类别的邮件。
+// 退订只针对非事务性邮件，激活账户等事务性邮件仍然会发送给退订的地址。
+func (m SuppressionModel) Suppressed(email, category string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM email_suppressions
+			WHERE email = lower($1)
+			AND (reason <> 'unsubscribed' OR $2 <> 'transactional')
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var suppressed bool
+	err := m.DB.QueryRowContext(ctx, query, email, category).Scan(&suppressed)
+	return suppressed, err
+}
+
+// GetAll 方法返回禁止发送名单，reason 为空时不进行过滤。
+func (m SuppressionModel) GetAll(reason string, filters Filters) ([]*EmailSuppression, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), email, reason, created_at
+		FROM email_suppressions
+		WHERE (reason = $1 OR $1 = '')
+		ORDER BY %s, email ASC
+		LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, reason, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var totalRecords int
+	var suppressions []*EmailSuppression
+
+	for rows.Next() {
+		var suppression EmailSuppression
+		err := rows.Scan(&totalRecords, &suppression.Email, &suppression.Reason, &suppression.CreatedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		suppressions = append(suppressions, &suppression)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return suppressions, metadata, nil
+}
+
+// Delete 方法将地址从禁止发送名单中移除，地址不在名单中时返回 ErrRecordNotFound。
+func (m SuppressionModel) Delete(email string) error {
+	query := `
+		DELETE FROM email_suppressions
+		WHERE email = lower($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, email)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
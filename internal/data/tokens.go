@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"database/sql"
 	"encoding/base32"
 	"time"
 
@@ -25,7 +24,7 @@ type Token struct {
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -93,3 +92,20 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteExpired 删除所有已经过期的令牌，返回删除的行数
+func (m TokenModel) DeleteExpired() (int64, error) {
+	query := `
+		DELETE FROM tokens
+        WHERE expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
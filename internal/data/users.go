@@ -24,6 +24,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale"`
 	Version   int       `json:"-"`
 }
 
@@ -33,7 +34,7 @@ type password struct {
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 // Set 方法用于将明文密码 plaintextPassword 转换为哈希值，并将其保存在 p.hash 字段中。
@@ -77,11 +78,19 @@ func ValidatePasswordPlaintext(v *validator.Validator, passwd string) {
 	v.Check(len(passwd) <= 72, "password", "must not be more than 72 bytes long")
 }
 
+// ValidateLocale 方法检查语言标签是否有效，例如 en 或 zh-CN。
+func ValidateLocale(v *validator.Validator, locale string) {
+	v.Check(locale != "", "locale", "must be provided")
+	v.Check(len(locale) <= 35, "locale", "must not be more than 35 bytes long")
+	v.Check(validator.Matches(locale, validator.LocaleRX), "locale", "must be a valid language tag such as en or zh-CN")
+}
+
 // ValidateUser 方法检查用户结构体中的值是否有效。如果有错误，方法会将错误添加到 v.Errors 中。
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Name != "", "name", "must be provided")
 	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
 	ValidateEmail(v, user.Email)
+	ValidateLocale(v, user.Locale)
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
 	}
@@ -94,14 +103,15 @@ func ValidateUser(v *validator.Validator, user *User) {
 // Insert 方法将一个新用户添加到 users 数据表中。
 func (m UserModel) Insert(user *User) error {
 	query := `
-		INSERT INTO users (name, email, password_hash, activated) 
-        VALUES ($1, $2, $3, $4)
+		INSERT INTO users (name, email, password_hash, activated, locale)
+        VALUES ($1, $2, $3, $4, $5)
         RETURNING id, created_at, version`
 	args := []any{
 		user.Name,
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -120,10 +130,48 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+// Get 方法返回指定 ID 的用户记录。
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, locale, version
+        FROM users
+        WHERE id = $1`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Locale,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 // GetByEmail 方法返回与指定电子邮件地址匹配的用户记录。
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, locale, version
         FROM users
         WHERE email = $1`
 
@@ -139,6 +187,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 
@@ -157,8 +206,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 		UPDATE users 
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, activated = $4, locale = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version`
 
 	args := []any{
@@ -166,6 +215,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 		user.ID,
 		user.Version,
 	}
@@ -193,7 +243,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	// tokenHash 是一个长度为 32 字节的字节数组，我们将其作为查询参数传入
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.locale, users.version
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -217,6 +267,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 	if err != nil {
@@ -232,6 +283,25 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	return &user, nil
 }
 
+// DeleteUnactivated 方法删除注册时间早于 olderThan 之前且从未激活的用户，返回删除的行数。
+// 用户的令牌和权限通过外键级联删除。
+func (m UserModel) DeleteUnactivated(olderThan time.Duration) (int64, error) {
+	query := `
+		DELETE FROM users
+        WHERE activated = false
+        AND created_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
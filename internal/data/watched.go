@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/Alphasxd/greenlight/internal/validator"
+)
+
+// Watched 是用户看过一部电影的记录，同一部电影可以看多次
+type Watched struct {
+	ID        int64     `json:"id"`
+	Movie     *Movie    `json:"movie"`
+	WatchedOn Date      `json:"watched_on"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WatchedModel struct {
+	DB DBTX
+}
+
+// ValidateWatched 方法检查观看日期是否有效。
+func ValidateWatched(v *validator.Validator, watched *Watched) {
+	v.Check(!watched.WatchedOn.IsZero(), "watched_on", "must be provided")
+	v.Check(!watched.WatchedOn.After(Today()), "watched_on", "must not be in the future")
+}
+
+// Insert 方法为用户添加一条观看记录，电影不存在时返回 ErrRecordNotFound。
+func (m WatchedModel) Insert(userID int64, watched *Watched) error {
+	query := `
+		INSERT INTO watched (user_id, movie_id, watched_on)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, watched.Movie.ID, watched.WatchedOn).Scan(&watched.ID, &watched.CreatedAt)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), `foreign key constraint "watched_movie_id_fkey"`):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAllForUser 方法返回用户的观看记录。
+func (m WatchedModel) GetAllForUser(userID int64, filters Filters) ([]*Watched, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), watched.id, watched.watched_on, watched.created_at,
+		       movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+		       movies.rating, movies.rating_count, movies.version
+		FROM watched
+		INNER JOIN movies ON movies.id = watched.movie_id
+		WHERE watched.user_id = $1
+		ORDER BY %s, watched.id DESC
+		LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			return
+		}
+	}(rows)
+
+	var totalRecords int
+	var history []*Watched
+
+	for rows.Next() {
+		watched := Watched{Movie: &Movie{}}
+		err := rows.Scan(
+			&totalRecords,
+			&watched.ID,
+			&watched.WatchedOn,
+			&watched.CreatedAt,
+			&watched.Movie.ID,
+			&watched.Movie.CreatedAt,
+			&watched.Movie.Title,
+			&watched.Movie.Year,
+			&watched.Movie.Runtime,
+			pq.Array(&watched.Movie.Genres),
+			&watched.Movie.Rating,
+			&watched.Movie.RatingCount,
+			&watched.Movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		history = append(history, &watched)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return history, metadata, nil
+}
+
+// Delete 方法删除用户的一条观看记录，记录不存在或者属于其他用户时返回 ErrRecordNotFound。
+func (m WatchedModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM watched
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -2,9 +2,11 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 )
@@ -33,6 +35,22 @@ func (l Level) String() string {
 	}
 }
 
+// ParseLevel 将日志级别字符串（不区分大小写）转换为 Level
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "INFO":
+		return LevelInfo, nil
+	case "ERROR":
+		return LevelError, nil
+	case "FATAL":
+		return LevelFatal, nil
+	case "OFF":
+		return LevelOff, nil
+	default:
+		return LevelInfo, fmt.Errorf("invalid log level %q", s)
+	}
+}
+
 // Logger 定义日志结构体，包含输出流、最小日志级别、互斥锁
 type Logger struct {
 	out      io.Writer
@@ -48,6 +66,22 @@ func New(out io.Writer, minLevel Level) *Logger {
 	}
 }
 
+// SetLevel 修改最小日志级别，可以在运行时安全地调用
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.minLevel = level
+}
+
+// level 返回当前的最小日志级别
+func (l *Logger) level() Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.minLevel
+}
+
 func (l *Logger) PrintInfo(msg string, properties map[string]string) {
 	_, err := l.print(LevelInfo, msg, properties)
 	if err != nil {
@@ -73,7 +107,7 @@ func (l *Logger) PrintFatal(err error, properties map[string]string) {
 
 // 内置打印方法，包含日志级别、日志信息、日志属性
 func (l *Logger) print(level Level, msg string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+	if level < l.level() {
 		return 0, nil
 	}
 	// 匿名结构体，包含日志级别、时间、日志信息、日志属性、堆栈信息
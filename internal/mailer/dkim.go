@@ -0,0 +1,179 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dkimHeaders 是参与签名的头部，不存在的头部会被跳过
+var dkimHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type",
+	"List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// wspRX 匹配连续的空格和制表符，relaxed 规范化算法将它们替换为一个空格
+var wspRX = regexp.MustCompile(`[ \t]+`)
+
+// DKIMSigner 按照 RFC 6376 为邮件添加 DKIM-Signature 头部，使用 rsa-sha256 算法和 relaxed/relaxed 规范化算法。
+// 收件方通过 <selector>._domainkey.<domain> 的 DNS TXT 记录中的公钥验证签名。
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	key      *rsa.PrivateKey
+}
+
+// NewDKIMSigner 从 keyFile 中读取 PEM 格式的 RSA 私钥（PKCS #1 或 PKCS #8）并创建一个 DKIMSigner
+func NewDKIMSigner(domain, selector, keyFile string) (*DKIMSigner, error) {
+	pemBytes, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("dkim: no PEM data found in %s", keyFile)
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = parsed.(*rsa.PrivateKey); !ok {
+				err = errors.New("dkim: private key is not an RSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("dkim: unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &DKIMSigner{
+		Domain:   domain,
+		Selector: selector,
+		key:      key,
+	}, nil
+}
+
+// Sign 为 raw 中的邮件计算签名，返回在最前面添加了 DKIM-Signature 头部的邮件
+func (s *DKIMSigner) Sign(raw []byte) ([]byte, error) {
+	header, body, found := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !found {
+		return nil, errors.New("dkim: message has no body")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	fields := parseHeaderFields(string(header) + "\r\n")
+
+	h := sha256.New()
+	var signed []string
+
+	for _, name := range dkimHeaders {
+		// 同名的头部出现多次时，从下往上选取，与验证方的处理方式一致
+		for i := len(fields) - 1; i >= 0; i-- {
+			if strings.EqualFold(fields[i].name, name) {
+				h.Write([]byte(relaxedHeader(fields[i].name, fields[i].value) + "\r\n"))
+				signed = append(signed, strings.ToLower(name))
+				break
+			}
+		}
+	}
+
+	tags := []string{
+		"v=1",
+		"a=rsa-sha256",
+		"c=relaxed/relaxed",
+		"d=" + s.Domain,
+		"s=" + s.Selector,
+		"t=" + strconv.FormatInt(time.Now().Unix(), 10),
+		"h=" + strings.Join(signed, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}
+	value := strings.Join(tags, "; ")
+
+	// DKIM-Signature 头部自身也参与签名，此时 b= 的值为空，并且末尾没有 CRLF
+	h.Write([]byte(relaxedHeader("DKIM-Signature", value)))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	value += base64.StdEncoding.EncodeToString(sig)
+
+	// 在标签之间折行，relaxed 规范化算法会将折行还原为一个空格，不影响签名
+	signature := "DKIM-Signature: " + strings.ReplaceAll(value, "; ", ";\r\n ") + "\r\n"
+
+	return append([]byte(signature), raw...), nil
+}
+
+type headerField struct {
+	name  string
+	value string
+}
+
+// parseHeaderFields 解析邮件的头部，以空格或制表符开头的行是上一个头部的延续
+func parseHeaderFields(header string) []headerField {
+	var fields []headerField
+
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+
+		name, value, _ := strings.Cut(line, ":")
+		fields = append(fields, headerField{name: name, value: value})
+	}
+
+	return fields
+}
+
+// relaxedHeader 按照 relaxed 算法规范化一个头部：名称转为小写，展开折行，合并空白字符并去掉值两端的空白
+func relaxedHeader(name, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = wspRX.ReplaceAllString(value, " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value)
+}
+
+// relaxedBody 按照 relaxed 算法规范化邮件正文：合并每行中的空白字符，去掉行尾的空白和正文末尾的空行
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(wspRX.ReplaceAllString(line, " "), " ")
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
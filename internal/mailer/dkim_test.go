@@ -0,0 +1,159 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const dkimTestMessage = "From: Greenlight <no-reply@example.com>\r\n" +
+	"To: alice@example.com\r\n" +
+	"Subject: Welcome   to\r\n" +
+	"\tGreenlight\r\n" +
+	"Date: Sun, 18 Oct 2026 10:00:00 +0000\r\n" +
+	"Message-ID: <1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"Hi  there, \r\n" +
+	"\r\n" +
+	"Thanks for signing up.\r\n" +
+	"\r\n" +
+	"\r\n"
+
+// newTestDKIMSigner 生成一个 RSA 密钥，写入临时文件后创建 DKIMSigner，返回签名器和对应的公钥
+func newTestDKIMSigner(t *testing.T) (*DKIMSigner, *rsa.PublicKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "dkim.pem")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewDKIMSigner("example.com", "mail", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer, &key.PublicKey
+}
+
+// verifyDKIM 像收件方一样解析签名后的邮件并验证 DKIM-Signature 头部中的 bh= 和 b=。
+// 规范化算法在这里独立实现，而不是复用签名时的函数。
+func verifyDKIM(t *testing.T, message []byte, pub *rsa.PublicKey) error {
+	t.Helper()
+
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(message)))
+
+	// ReadMIMEHeader 展开折行时用一个空格连接各行，与 relaxed 算法的结果相同
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(reader.R)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wsp := regexp.MustCompile(`[ \t]+`)
+	canonHeader := func(name, value string) string {
+		return strings.ToLower(name) + ":" + strings.TrimSpace(wsp.ReplaceAllString(value, " "))
+	}
+
+	signature := header.Get("DKIM-Signature")
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(signature, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(tag), "=")
+		tags[name] = strings.Join(strings.Fields(value), "")
+	}
+
+	if tags["a"] != "rsa-sha256" || tags["c"] != "relaxed/relaxed" || tags["d"] != "example.com" || tags["s"] != "mail" {
+		t.Fatalf("unexpected signature tags: %v", tags)
+	}
+
+	// 正文：合并每行中的空白字符，去掉行尾的空白和末尾的空行
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(wsp.ReplaceAllString(line, " "), " ")
+	}
+	canonBody := strings.TrimRight(strings.Join(lines, "\r\n"), "\r\n") + "\r\n"
+
+	bodyHash := sha256.Sum256([]byte(canonBody))
+	if got := base64.StdEncoding.EncodeToString(bodyHash[:]); got != tags["bh"] {
+		return fmt.Errorf("body hash mismatch: got %s, signature has %s", got, tags["bh"])
+	}
+
+	h := sha256.New()
+	for _, name := range strings.Split(tags["h"], ":") {
+		values := header.Values(name)
+		if len(values) == 0 {
+			t.Fatalf("signed header %q not found", name)
+		}
+		h.Write([]byte(canonHeader(name, values[len(values)-1]) + "\r\n"))
+	}
+
+	// 计算签名时 b= 的值为空
+	unsigned := regexp.MustCompile(`(^|;\s*)b=[^;]*`).ReplaceAllString(signature, "${1}b=")
+	h.Write([]byte(canonHeader("DKIM-Signature", unsigned)))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, h.Sum(nil), sig)
+}
+
+func TestDKIMSignerSign(t *testing.T) {
+	signer, pub := newTestDKIMSigner(t)
+
+	signed, err := signer.Sign([]byte(dkimTestMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(signed, []byte("DKIM-Signature: ")) {
+		t.Fatalf("signed message does not start with DKIM-Signature:\n%s", signed)
+	}
+
+	if err := verifyDKIM(t, signed, pub); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+
+	// 修改已签名的头部或正文后签名不再有效
+	tampered := bytes.Replace(signed, []byte("Subject: Welcome"), []byte("Subject: Goodbye"), 1)
+	if err := verifyDKIM(t, tampered, pub); err == nil {
+		t.Error("signature verifies after changing the subject")
+	}
+
+	tampered = bytes.Replace(signed, []byte("Thanks"), []byte("thanks"), 1)
+	if err := verifyDKIM(t, tampered, pub); err == nil {
+		t.Error("signature verifies after changing the body")
+	}
+}
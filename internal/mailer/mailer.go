@@ -2,70 +2,324 @@ package mailer
 
 import (
 	"bytes"
+	"crypto/rand"
 	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
+	"net/mail"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/go-mail/mail"
+	gomail "github.com/go-mail/mail"
 )
 
 //go:embed "templates"
 var templateFS embed.FS
 
+// CategoryTransactional 是事务性邮件的类别，例如欢迎邮件和密码重置邮件。
+// 模板可以通过 {{define "category"}}newsletter{{end}} 声明其它类别，其它类别的邮件会带有 List-Unsubscribe 头部。
+const CategoryTransactional = "transactional"
+
+// ErrSuppressed 表示收件人在禁止发送名单中，邮件没有被发送
+var ErrSuppressed = errors.New("mailer: recipient is suppressed")
+
+// Message 是一封已经渲染好的邮件
+type Message struct {
+	ID        string // Message-ID 头部的值，包括尖括号
+	Date      time.Time
+	From      string
+	To        string
+	Subject   string
+	Category  string
+	Headers   map[string]string // 额外的头部，例如 List-Unsubscribe
+	PlainBody string
+	HTMLBody  string
+
+	raw []byte // 编码（以及 DKIM 签名）之后的邮件，发送时原样写出，保证签名有效
+}
+
+// Sender 定义了邮件的发送方式，例如 SMTP、写入文件、记录日志或者保存在内存中
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// SuppressionList 是禁止发送的收件人名单，例如退信或者退订的地址，category 为邮件的类别
+type SuppressionList interface {
+	Suppressed(recipient, category string) (bool, error)
+}
+
+// Options 是 Mailer 的可选功能，零值表示都不启用
+type Options struct {
+	DKIM           *DKIMSigner                   // 为邮件添加 DKIM 签名
+	Suppressions   SuppressionList               // 发送之前检查收件人是否被禁止
+	UnsubscribeURL func(recipient string) string // 非事务性邮件的一键退订地址
+}
+
 type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+	sender    Sender
+	from      string
+	options   Options
+	templates map[string]*template.Template // 文件名（例如 user_welcome.zh-CN.tmpl）到模板的映射
 }
 
-// New 创建一个新的 Mailer 实例，并将其作为函数返回。
-func New(host string, port int, username, passwd, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, passwd)
-	dialer.Timeout = 5 * time.Second
+// New 创建一个新的 Mailer 实例，使用 sender 发送邮件，from 作为发件人。
+// 所有模板在这里解析一次，模板有错误时返回错误，而不是等到发送邮件时才发现。
+func New(sender Sender, from string, options Options) (Mailer, error) {
+	templates, err := parseTemplates()
+	if err != nil {
+		return Mailer{}, err
+	}
 
 	return Mailer{
-		dialer: dialer,
-		sender: sender,
+		sender:    sender,
+		from:      from,
+		options:   options,
+		templates: templates,
+	}, nil
+}
+
+// parseTemplates 解析 templates 目录下的所有邮件模板。
+// 每个模板都基于 layouts 中的布局和 partials 中的片段，模板只需要定义 subject、plainContent 和 htmlContent，
+// 也可以重新定义布局中的 plainSignature 和 htmlSignature 等块。
+func parseTemplates() (map[string]*template.Template, error) {
+	base, err := template.New("email").ParseFS(templateFS, "templates/layouts/*.tmpl", "templates/partials/*.tmpl")
+	if err != nil {
+		return nil, err
 	}
+
+	files, err := fs.Glob(templateFS, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make(map[string]*template.Template, len(files))
+
+	for _, file := range files {
+		tmpl, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl, err = tmpl.ParseFS(templateFS, file)
+		if err != nil {
+			return nil, err
+		}
+
+		templates[path.Base(file)] = tmpl
+	}
+
+	return templates, nil
+}
+
+// Templates 返回所有模板的文件名，按字母顺序排列
+func (m Mailer) Templates() []string {
+	names := make([]string, 0, len(m.templates))
+	for name := range m.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func (m Mailer) Send(recipient, templateFile string, data any) error {
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+// lookup 查找 templateFile 对应 locale 的翻译，例如 locale 为 zh-CN 时依次查找
+// user_welcome.zh-CN.tmpl 和 user_welcome.zh.tmpl，都不存在时使用英文的 user_welcome.tmpl。
+func (m Mailer) lookup(templateFile, locale string) (*template.Template, error) {
+	name := strings.TrimSuffix(templateFile, ".tmpl")
+
+	var candidates []string
+	if locale != "" {
+		candidates = append(candidates, name+"."+locale+".tmpl")
+		if lang, _, found := strings.Cut(locale, "-"); found {
+			candidates = append(candidates, name+"."+lang+".tmpl")
+		}
+	}
+	candidates = append(candidates, templateFile)
+
+	for _, candidate := range candidates {
+		if tmpl, ok := m.templates[candidate]; ok {
+			return tmpl, nil
+		}
+	}
+
+	return nil, fmt.Errorf("mailer: template %q not found", templateFile)
+}
+
+// Render 使用 locale 对应的模板渲染邮件的主题和正文，返回的邮件还没有收件人和 Message-ID。
+func (m Mailer) Render(templateFile, locale string, data any) (*Message, error) {
+	tmpl, err := m.lookup(templateFile, locale)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 执行 “subject” 模板，将其输出写入到 bytes.Buffer 中
 	subject := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(subject, "subject", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 执行 “plainBody” 模板，将其输出写入到 bytes.Buffer 中
 	plainBody := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 执行 “htmlBody” 模板，将其输出写入到 bytes.Buffer 中
 	htmlBody := new(bytes.Buffer)
 	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// 没有声明类别的模板都是事务性邮件
+	category := CategoryTransactional
+	if tmpl.Lookup("category") != nil {
+		buf := new(bytes.Buffer)
+		err = tmpl.ExecuteTemplate(buf, "category", data)
+		if err != nil {
+			return nil, err
+		}
+		category = strings.TrimSpace(buf.String())
+	}
+
+	msg := &Message{
+		From:      m.from,
+		Subject:   subject.String(),
+		Category:  category,
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+	return msg, nil
+}
+
+// Send 使用 locale 对应的模板渲染并发送邮件，返回邮件的 Message-ID，邮件服务商通过它来追踪邮件。
+// 收件人在禁止发送名单中时返回 ErrSuppressed。
+func (m Mailer) Send(recipient, templateFile, locale string, data any) (string, error) {
+	msg, err := m.Render(templateFile, locale, data)
+	if err != nil {
+		return "", err
+	}
+
+	if m.options.Suppressions != nil {
+		suppressed, err := m.options.Suppressions.Suppressed(recipient, msg.Category)
+		if err != nil {
+			return "", err
+		}
+		if suppressed {
+			return "", ErrSuppressed
+		}
+	}
+
+	msg.To = recipient
+	msg.Date = time.Now()
+
+	msg.ID, err = newMessageID(m.from)
+	if err != nil {
+		return "", err
+	}
+
+	// 非事务性邮件按照 RFC 8058 添加一键退订的头部
+	if msg.Category != CategoryTransactional && m.options.UnsubscribeURL != nil {
+		msg.Headers = map[string]string{
+			"List-Unsubscribe":      "<" + m.options.UnsubscribeURL(recipient) + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+
+	err = msg.encode(m.options.DKIM)
+	if err != nil {
+		return "", err
+	}
 
-	// 使用 DialAndSend() 方法发送消息
-	err = m.dialer.DialAndSend(msg)
+	err = m.sender.Send(msg)
+	if err != nil {
+		return "", err
+	}
+
+	return msg.ID, nil
+}
+
+// Ping 检查邮件发送方式是否可用，只有 SMTP 需要检查，其它发送方式总是可用
+func (m Mailer) Ping() error {
+	if p, ok := m.sender.(interface{ Ping() error }); ok {
+		return p.Ping()
+	}
+	return nil
+}
+
+// newMessageID 生成一个全局唯一的 Message-ID，域名部分使用发件人地址的域名
+func newMessageID(from string) (string, error) {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if i := strings.LastIndexByte(addr.Address, '@'); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">", nil
+}
+
+// mime 将邮件转换为 MIME 格式的 mail.Message
+func (msg *Message) mime() *gomail.Message {
+	mm := gomail.NewMessage()
+	if msg.ID != "" {
+		mm.SetHeader("Message-ID", msg.ID)
+	}
+	if !msg.Date.IsZero() {
+		mm.SetDateHeader("Date", msg.Date)
+	}
+	for name, value := range msg.Headers {
+		mm.SetHeader(name, value)
+	}
+	mm.SetHeader("To", msg.To)
+	mm.SetHeader("From", msg.From)
+	mm.SetHeader("Subject", msg.Subject)
+	mm.SetBody("text/plain", msg.PlainBody)
+	mm.AddAlternative("text/html", msg.HTMLBody)
+	return mm
+}
+
+// encode 将邮件编码为 RFC 5322 格式，dkim 不为 nil 时同时添加 DKIM 签名。
+// MIME 分隔符在每次编码时随机生成，所以签名之后只能发送这里保存的字节。
+func (msg *Message) encode(dkim *DKIMSigner) error {
+	buf := new(bytes.Buffer)
+	_, err := msg.mime().WriteTo(buf)
 	if err != nil {
 		return err
 	}
+
+	raw := buf.Bytes()
+	if dkim != nil {
+		raw, err = dkim.Sign(raw)
+		if err != nil {
+			return err
+		}
+	}
+
+	msg.raw = raw
 	return nil
 }
+
+// WriteTo 将邮件以 RFC 5322 格式（即 .eml 文件的格式）写入 w
+func (msg *Message) WriteTo(w io.Writer) (int64, error) {
+	if msg.raw == nil {
+		return msg.mime().WriteTo(w)
+	}
+
+	n, err := w.Write(msg.raw)
+	return int64(n), err
+}
@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Alphasxd/greenlight/internal/jsonlog"
+	gomail "github.com/go-mail/mail"
+)
+
+// SMTPSender 通过 SMTP 服务器发送邮件
+type SMTPSender struct {
+	dialer *gomail.Dialer
+}
+
+// NewSMTPSender 创建一个连接到指定 SMTP 服务器的 SMTPSender
+func NewSMTPSender(host string, port int, username, passwd string) *SMTPSender {
+	dialer := gomail.NewDialer(host, port, username, passwd)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPSender{dialer: dialer}
+}
+
+// Send 发送编码之后的邮件，而不是重新生成 MIME 消息，这样 DKIM 签名覆盖的内容与实际发送的内容一致
+func (s *SMTPSender) Send(msg *Message) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return err
+	}
+
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	sc, err := s.dialer.Dial()
+	if err != nil {
+		return err
+	}
+
+	err = sc.Send(from.Address, []string{to.Address}, msg)
+	if err != nil {
+		_ = sc.Close()
+		return err
+	}
+
+	return sc.Close()
+}
+
+// Ping 连接到 SMTP 服务器并完成认证，然后立即关闭连接，用来检查 SMTP 服务器是否可用
+func (s *SMTPSender) Ping() error {
+	sc, err := s.dialer.Dial()
+	if err != nil {
+		return err
+	}
+	return sc.Close()
+}
+
+// FileSender 将每封邮件保存为目录中的一个 .eml 文件，适用于本地开发
+type FileSender struct {
+	Dir string
+}
+
+func (s *FileSender) Send(msg *Message) error {
+	err := os.MkdirAll(s.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	_, err = rand.Read(suffix)
+	if err != nil {
+		return err
+	}
+
+	// 文件名以时间开头，按文件名排序就是发送的顺序
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	f, err := os.Create(filepath.Join(s.Dir, name))
+	if err != nil {
+		return err
+	}
+
+	_, err = msg.WriteTo(f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// LogSender 不发送邮件，只通过 jsonlog 记录邮件的收件人、主题和 Message-ID。
+// 正文中可能包含激活令牌等敏感信息，所以不会被记录，需要查看正文时使用 FileSender
+type LogSender struct {
+	Logger *jsonlog.Logger
+}
+
+func (s *LogSender) Send(msg *Message) error {
+	s.Logger.PrintInfo("email not sent (log transport)", map[string]string{
+		"message_id": msg.ID,
+		"from":       msg.From,
+		"to":         msg.To,
+		"subject":    msg.Subject,
+	})
+	return nil
+}
+
+// MemorySender 将邮件保存在内存中，用于测试中检查发送了哪些邮件
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []*Message
+}
+
+func (s *MemorySender) Send(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages 返回已经发送的邮件的副本
+func (s *MemorySender) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Message(nil), s.messages...)
+}
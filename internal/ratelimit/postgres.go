@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore 将每个 key 的 TAT 保存在 rate_limits 数据表中，所有连接到同一个数据库的实例共享同一份配额
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+// NewPostgresStore 创建一个 PostgresStore，并启动一个后台 goroutine 定期清理已经恢复为满的令牌桶
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	s := &PostgresStore{DB: db}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			// 多个实例同时执行清理也没有关系，失败的清理会在下一分钟重试
+			_, _ = s.DB.ExecContext(ctx, `DELETE FROM rate_limits WHERE tat < now()`)
+			cancel()
+		}
+	}()
+
+	return s
+}
+
+// Allow 检查 key 对应的令牌桶是否允许当前请求，并消耗一个令牌。
+// 整个检查在一个事务中完成，并使用数据库的时钟，避免各实例之间的时钟偏差。
+func (s *PostgresStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	// ON CONFLICT DO UPDATE 会锁住已有的行，直到事务结束，这样并发的请求会依次计算
+	query := `
+		INSERT INTO rate_limits (key, tat)
+		VALUES ($1, now())
+		ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+		RETURNING tat, now()`
+
+	var tat, now time.Time
+
+	err = tx.QueryRowContext(ctx, query, key).Scan(&tat, &now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	newTat, result := limit.take(tat, now)
+
+	if result.Allowed {
+		_, err = tx.ExecContext(ctx, `UPDATE rate_limits SET tat = $1 WHERE key = $2`, newTat, key)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
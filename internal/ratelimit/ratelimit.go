@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store 定义了限流状态的存储后端，多个实例共享同一个 Store 时会共同遵守同一份配额
+type Store interface {
+	// Allow 检查 key 对应的令牌桶是否允许当前请求，并消耗一个令牌
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Limit 描述一个令牌桶配额：每秒补充 Rate 个令牌，桶的容量为 Burst
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result 表示一次限流检查的结果，字段与 RateLimit-* 响应头一一对应
+type Result struct {
+	Allowed    bool
+	Limit      int           // 桶的容量
+	Remaining  int           // 当前还可以发起的请求数
+	Reset      time.Duration // 令牌桶完全恢复所需的时间
+	RetryAfter time.Duration // 请求被拒绝时，距离下一个令牌可用的时间
+}
+
+// interval 返回补充一个令牌所需的时间
+func (l Limit) interval() time.Duration {
+	return time.Duration(float64(time.Second) / l.Rate)
+}
+
+// take 使用 GCRA（通用信元速率算法）计算一次请求的结果。
+// tat（theoretical arrival time）是桶恢复为满的时间点，返回值中的 time.Time 是新的 tat。
+func (l Limit) take(tat, now time.Time) (time.Time, Result) {
+	interval := l.interval()
+	tolerance := time.Duration(l.Burst) * interval
+
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTat := tat.Add(interval)
+	allowAt := newTat.Add(-tolerance)
+
+	// 当前时间早于允许的时间点，说明桶里已经没有令牌了
+	if now.Before(allowAt) {
+		return tat, Result{
+			Allowed:    false,
+			Limit:      l.Burst,
+			Remaining:  0,
+			Reset:      tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}
+	}
+
+	return newTat, Result{
+		Allowed:   true,
+		Limit:     l.Burst,
+		Remaining: int(now.Sub(allowAt) / interval),
+		Reset:     newTat.Sub(now),
+	}
+}
+
+// MemoryStore 在进程内存中保存每个 key 的限流状态，只适用于单实例部署
+type MemoryStore struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+}
+
+// NewMemoryStore 创建一个 MemoryStore，并启动一个后台 goroutine 定期清理已经恢复为满的令牌桶
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		tats: make(map[string]time.Time),
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			s.mu.Lock()
+			now := time.Now()
+			for key, tat := range s.tats {
+				// 令牌桶已经恢复为满，保留它和删除它没有区别
+				if tat.Before(now) {
+					delete(s.tats, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}()
+
+	return s
+}
+
+// Allow 检查 key 对应的令牌桶是否允许当前请求，并消耗一个令牌
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tat, result := limit.take(s.tats[key], time.Now())
+	s.tats[key] = tat
+
+	return result, nil
+}
@@ -0,0 +1,4 @@
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key text PRIMARY KEY,
+    tat timestamp(6) with time zone NOT NULL
+);
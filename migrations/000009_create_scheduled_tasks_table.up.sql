@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS scheduled_tasks (
+    name text PRIMARY KEY,
+    last_run_at timestamp(0) with time zone NOT NULL,
+    last_status text NOT NULL,
+    last_error text NOT NULL DEFAULT '',
+    last_duration_ms bigint NOT NULL DEFAULT 0,
+    last_affected_rows bigint NOT NULL DEFAULT 0
+);
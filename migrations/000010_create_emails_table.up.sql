@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS emails (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    recipient text NOT NULL,
+    template text NOT NULL,
+    data jsonb NOT NULL DEFAULT '{}',
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL,
+    next_attempt_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_at timestamp(0) with time zone,
+    last_error text NOT NULL DEFAULT '',
+    message_id text NOT NULL DEFAULT '',
+    sent_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS emails_status_next_attempt_at_idx ON emails (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS emails_user_id_idx ON emails (user_id);
+
+INSERT INTO permissions (code)
+VALUES
+    ('emails:read');
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT 'en';
+ALTER TABLE emails ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT 'en';
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'emails:write';
+DROP TABLE IF EXISTS email_suppressions;
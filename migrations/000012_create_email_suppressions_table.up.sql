@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS email_suppressions (
+    email text PRIMARY KEY,
+    reason text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('emails:write');
@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE code = 'reviews:moderate';
+DROP TRIGGER IF EXISTS reviews_update_movie_rating ON reviews;
+DROP FUNCTION IF EXISTS reviews_update_movie_rating();
+ALTER TABLE movies DROP COLUMN IF EXISTS rating;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_sum;
+ALTER TABLE movies DROP COLUMN IF EXISTS rating_count;
+DROP TABLE IF EXISTS reviews;
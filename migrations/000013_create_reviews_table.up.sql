@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS reviews (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    score smallint NOT NULL,
+    body text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (movie_id, user_id)
+);
+
+ALTER TABLE reviews ADD CONSTRAINT reviews_score_check CHECK (score BETWEEN 1 AND 10);
+
+CREATE INDEX IF NOT EXISTS reviews_movie_id_idx ON reviews (movie_id);
+
+-- rating 由 rating_sum 和 rating_count 计算得到，可以直接用于排序
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_sum bigint NOT NULL DEFAULT 0;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating numeric(4, 2) GENERATED ALWAYS AS (
+    CASE WHEN rating_count = 0 THEN 0 ELSE round(rating_sum::numeric / rating_count, 2) END
+) STORED;
+
+-- 通过触发器维护电影的评分，这样级联删除用户或电影时评分也保持一致
+CREATE OR REPLACE FUNCTION reviews_update_movie_rating() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE movies SET rating_count = rating_count - 1, rating_sum = rating_sum - OLD.score
+        WHERE id = OLD.movie_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE movies SET rating_count = rating_count + 1, rating_sum = rating_sum + NEW.score
+        WHERE id = NEW.movie_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reviews_update_movie_rating
+AFTER INSERT OR DELETE OR UPDATE OF score, movie_id ON reviews
+FOR EACH ROW EXECUTE FUNCTION reviews_update_movie_rating();
+
+INSERT INTO permissions (code)
+VALUES
+    ('reviews:moderate');
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS people (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    birth_date date,
+    biography text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS people_name_idx ON people USING GIN (to_tsvector('simple', name));
+
+-- credits 记录人物在电影中的职位，演员同时记录饰演的角色，billing_order 决定演职员表中的顺序
+CREATE TABLE IF NOT EXISTS credits (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    person_id bigint NOT NULL REFERENCES people ON DELETE CASCADE,
+    role text NOT NULL,
+    character text NOT NULL DEFAULT '',
+    billing_order integer NOT NULL DEFAULT 0,
+    UNIQUE (movie_id, person_id, role, character)
+);
+
+ALTER TABLE credits ADD CONSTRAINT credits_role_check CHECK (role IN ('director', 'actor', 'writer'));
+
+CREATE INDEX IF NOT EXISTS credits_movie_id_idx ON credits (movie_id);
+CREATE INDEX IF NOT EXISTS credits_person_id_role_idx ON credits (person_id, role);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS movies_title_russian_idx;
+DROP INDEX IF EXISTS movies_title_portuguese_idx;
+DROP INDEX IF EXISTS movies_title_italian_idx;
+DROP INDEX IF EXISTS movies_title_spanish_idx;
+DROP INDEX IF EXISTS movies_title_german_idx;
+DROP INDEX IF EXISTS movies_title_french_idx;
+DROP INDEX IF EXISTS movies_title_english_idx;
+DROP INDEX IF EXISTS movies_title_trgm_idx;
+DROP EXTENSION IF EXISTS pg_trgm;
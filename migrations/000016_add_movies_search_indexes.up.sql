@@ -0,0 +1,13 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- 三元组索引用于标题的模糊匹配（did you mean）和搜索建议
+CREATE INDEX IF NOT EXISTS movies_title_trgm_idx ON movies USING GIN (title gin_trgm_ops);
+
+-- 每个支持的搜索语言一个全文索引，simple 的索引在创建 movies 表时已经存在
+CREATE INDEX IF NOT EXISTS movies_title_english_idx ON movies USING GIN (to_tsvector('english', title));
+CREATE INDEX IF NOT EXISTS movies_title_french_idx ON movies USING GIN (to_tsvector('french', title));
+CREATE INDEX IF NOT EXISTS movies_title_german_idx ON movies USING GIN (to_tsvector('german', title));
+CREATE INDEX IF NOT EXISTS movies_title_spanish_idx ON movies USING GIN (to_tsvector('spanish', title));
+CREATE INDEX IF NOT EXISTS movies_title_italian_idx ON movies USING GIN (to_tsvector('italian', title));
+CREATE INDEX IF NOT EXISTS movies_title_portuguese_idx ON movies USING GIN (to_tsvector('portuguese', title));
+CREATE INDEX IF NOT EXISTS movies_title_russian_idx ON movies USING GIN (to_tsvector('russian', title));
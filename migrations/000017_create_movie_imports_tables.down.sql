@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS movie_import_rows;
+DROP TABLE IF EXISTS movie_imports;
+DROP INDEX IF EXISTS movies_external_id_key;
+ALTER TABLE movies DROP COLUMN IF EXISTS external_id;
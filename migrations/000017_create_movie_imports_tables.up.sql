@@ -0,0 +1,34 @@
+-- external_id 是导入时使用的外部键，再次导入相同 external_id 的电影会更新已有的电影，NULL 不参与唯一性检查
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS external_id text;
+CREATE UNIQUE INDEX IF NOT EXISTS movies_external_id_key ON movies (external_id);
+
+CREATE TABLE IF NOT EXISTS movie_imports (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    format text NOT NULL,
+    dry_run boolean NOT NULL DEFAULT false,
+    status text NOT NULL DEFAULT 'uploading',
+    total_rows integer NOT NULL DEFAULT 0,
+    processed_rows integer NOT NULL DEFAULT 0,
+    created_rows integer NOT NULL DEFAULT 0,
+    updated_rows integer NOT NULL DEFAULT 0,
+    failed_rows integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone
+);
+
+-- 上传的每一行原样保存在这里，由后台任务逐批校验和导入，errors 记录这一行的校验错误
+CREATE TABLE IF NOT EXISTS movie_import_rows (
+    import_id bigint NOT NULL REFERENCES movie_imports ON DELETE CASCADE,
+    row_number integer NOT NULL,
+    data jsonb NOT NULL,
+    errors jsonb,
+    PRIMARY KEY (import_id, row_number)
+);
+
+CREATE INDEX IF NOT EXISTS movie_import_rows_errors_idx ON movie_import_rows (import_id, row_number) WHERE errors IS NOT NULL;
+
+-- 试运行时按 external_id 查找文件中之前的行
+CREATE INDEX IF NOT EXISTS movie_import_rows_external_id_idx ON movie_import_rows (import_id, (data->>'external_id'));
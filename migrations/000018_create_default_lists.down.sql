@@ -0,0 +1 @@
+-- 默认列表可能已经包含用户添加的电影，回滚时保留它们
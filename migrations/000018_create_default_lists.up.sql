@@ -0,0 +1,11 @@
+-- 默认的待看列表改为在注册时创建，为之前注册的用户补建默认列表
+-- 没有默认列表但已经有同名列表的用户，将这个列表标记为默认列表
+UPDATE lists
+SET is_default = true, updated_at = NOW(), version = version + 1
+WHERE name = 'Watchlist' AND NOT is_default
+AND NOT EXISTS (SELECT 1 FROM lists d WHERE d.user_id = lists.user_id AND d.is_default);
+
+INSERT INTO lists (user_id, name, is_default)
+SELECT id, 'Watchlist', true FROM users
+WHERE NOT EXISTS (SELECT 1 FROM lists WHERE lists.user_id = users.id AND lists.is_default)
+ON CONFLICT DO NOTHING;